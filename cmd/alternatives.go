@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+// Which end of the journey an alternative station replaces
+const (
+	AlternativeOrigin      = "origin"
+	AlternativeDestination = "destination"
+)
+
+func init() {
+	viper.SetDefault("alternatives.radius", 25.0)
+}
+
+// AlternativeFare is the cheapest season between a pair of stations where one end has been
+// swapped for a nearby station
+type AlternativeFare struct {
+	Replaces   string  `header:"replaces"`
+	From       string  `header:"from"`
+	To         string  `header:"to"`
+	Station    string  `header:"station"`
+	DistanceKm float64 `header:"distance_km"`
+	TicketCode string  `header:"ticket_code"`
+	Annual     float64 `header:"annual"`
+}
+
+// Alternative is an alternative's saving over the requested pair's annual season
+type Alternative struct {
+	AlternativeFare `header:"inline"`
+	Saving          float64 `header:"annual_saving"`
+	SavingRatio     float64 `header:"saving_pct"`
+}
+
+// nearestOthers returns the n closest stations that aren't the station itself
+func nearestOthers(near []*models.StationGeoDetail, crs string, n int) []*models.StationGeoDetail {
+	var others []*models.StationGeoDetail
+	for _, s := range near {
+		if s.CRS == crs {
+			continue
+		}
+		if len(others) == n {
+			break
+		}
+		others = append(others, s)
+	}
+	return others
+}
+
+// alternativeSavings works out each alternative's saving over the requested annual season,
+// biggest saving first
+func alternativeSavings(requested float64, fares []*AlternativeFare) []*Alternative {
+
+	alternatives := make([]*Alternative, len(fares))
+	for i, fare := range fares {
+		a := &Alternative{AlternativeFare: *fare}
+		a.Saving = Round(requested-a.Annual, 0.01)
+		if requested > 0 {
+			a.SavingRatio = Round(a.Saving/requested*100, 0.1)
+		}
+		alternatives[i] = a
+	}
+
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return alternatives[i].Saving > alternatives[j].Saving
+	})
+
+	return alternatives
+}
+
+// suggestAlternatives prices seasons from the n stations nearest the origin and to the n stations
+// nearest the destination, cheapest first
+func suggestAlternatives(ctx context.Context, repo repository.DtdRepository, catalogue models.TicketCatalogue, from, to, class string, n int) ([]*AlternativeFare, error) {
+
+	radius := viper.GetFloat64("alternatives.radius")
+
+	var alternatives []*AlternativeFare
+	for _, end := range []string{AlternativeOrigin, AlternativeDestination} {
+
+		moved := from
+		if end == AlternativeDestination {
+			moved = to
+		}
+
+		location, err := repo.FindStationGeo(moved)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding coordinates for %s", moved)
+		}
+
+		near, err := repo.FindStationsNear(location.Point(), radius, n+1)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, station := range nearestOthers(near, moved, n) {
+			alt := &AlternativeFare{
+				Replaces:   end,
+				From:       from,
+				To:         to,
+				Station:    station.Description,
+				DistanceKm: Round(station.DistanceKm, 0.1),
+			}
+			if end == AlternativeOrigin {
+				alt.From = station.CRS
+			} else {
+				alt.To = station.CRS
+			}
+
+			weekly, err := cheapestSeasonFare(ctx, repo, catalogue, alt.From, alt.To, class)
+			if err != nil {
+				logger.Debug("no season for alternative", zap.String("from", alt.From), zap.String("to", alt.To), zap.Error(err))
+				continue
+			}
+
+			alt.TicketCode = weekly.TicketCode
+			alt.Annual = calculateFares(weekly.AdultFare).AnnualStd
+			alternatives = append(alternatives, alt)
+		}
+	}
+
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return alternatives[i].Annual < alternatives[j].Annual
+	})
+
+	return alternatives, nil
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_nearestOthers(t *testing.T) {
+
+	near := []*models.StationGeoDetail{
+		{CRS: "WOK", DistanceKm: 0},
+		{CRS: "WKD", DistanceKm: 2.1},
+		{CRS: "BFN", DistanceKm: 3.4},
+		{CRS: "WBY", DistanceKm: 5.8},
+	}
+
+	got := nearestOthers(near, "WOK", 2)
+
+	assert.Len(t, got, 2)
+	assert.Equal(t, "WKD", got[0].CRS)
+	assert.Equal(t, "BFN", got[1].CRS)
+	assert.Len(t, nearestOthers(near, "XXX", 10), 4)
+}
+
+func Test_alternativeSavings(t *testing.T) {
+
+	alternatives := []*AlternativeFare{
+		{From: "WKD", To: "WAT", Annual: 3500},
+		{From: "BFN", To: "WAT", Annual: 2900},
+		{From: "WOK", To: "VXH", Annual: 3200},
+	}
+
+	got := alternativeSavings(3200, alternatives)
+
+	assert.Equal(t, "BFN", got[0].From)
+	assert.Equal(t, 300.0, got[0].Saving)
+	assert.Equal(t, 9.4, got[0].SavingRatio)
+	assert.Equal(t, "VXH", got[1].To)
+	assert.Equal(t, 0.0, got[1].Saving)
+	assert.Equal(t, -300.0, got[2].Saving)
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var (
+	batchInput   string
+	batchOutput  string
+	batchFormat  string
+	batchWorkers int
+)
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.Flags().StringVarP(&batchInput, "input", "i", "", "CSV of employee_id,from,to,class,period rows")
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "File to write results to (default stdout)")
+	batchCmd.Flags().StringVar(&batchFormat, "format", "csv", "Output format, csv or json")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", 4, "Number of journeys priced concurrently")
+	batchCmd.MarkFlagRequired("input")
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Price season tickets for a CSV of employee journeys",
+	Long: `Reads rows of employee_id, from CRS, to CRS, class (1 or 2) and period
+(weekly, monthly, 3-monthly, 6-monthly, annual or a number of days) and writes
+the resolved stations, cheapest season prices and totals. A row that cannot be
+priced is reported in its error column rather than stopping the batch.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, span := tracer.Start(cmd.Context(), "batch")
+		err := batch(ctx, batchInput, batchOutput, batchFormat, batchWorkers)
+		endSpan(span, err)
+		if err != nil {
+			logger.Error("error running batch", zap.Error(err))
+			shutdownTracing(ctx)
+			os.Exit(1)
+		}
+	},
+}
+
+// BatchJourney is a single row of the batch input
+type BatchJourney struct {
+	EmployeeID string `json:"employee_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Class      string `json:"class"`
+	Period     string `json:"period"`
+}
+
+// BatchResult is the priced outcome of a BatchJourney
+type BatchResult struct {
+	BatchJourney
+	FromName    string  `json:"from_name"`
+	ToName      string  `json:"to_name"`
+	TicketCode  string  `json:"ticket_code"`
+	Weekly      float64 `json:"weekly"`
+	Monthly     float64 `json:"monthly"`
+	Annual      float64 `json:"annual"`
+	PeriodPrice float64 `json:"period_price"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// BatchReport holds every result along with the total cost of the priced rows
+type BatchReport struct {
+	Results []*BatchResult `json:"results"`
+	Priced  int            `json:"priced"`
+	Failed  int            `json:"failed"`
+	Total   float64        `json:"total"`
+}
+
+var batchHeader = []string{
+	"employee_id", "from", "to", "class", "period",
+	"from_name", "to_name", "ticket_code", "weekly", "monthly", "annual", "period_price", "error",
+}
+
+// readJourneys parses the batch CSV, skipping a header row if there is one
+func readJourneys(r io.Reader) ([]*BatchJourney, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading journeys csv")
+	}
+
+	var journeys []*BatchJourney
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(record[0], "employee_id") {
+			continue
+		}
+		if len(record) < 3 {
+			return nil, errors.Errorf("line %d: expected at least employee_id,from,to", i+1)
+		}
+		j := &BatchJourney{
+			EmployeeID: record[0],
+			From:       strings.ToUpper(record[1]),
+			To:         strings.ToUpper(record[2]),
+			Class:      "2",
+			Period:     PeriodAnnual,
+		}
+		if len(record) > 3 && record[3] != "" {
+			j.Class = record[3]
+		}
+		if len(record) > 4 && record[4] != "" {
+			j.Period = record[4]
+		}
+		journeys = append(journeys, j)
+	}
+
+	return journeys, nil
+}
+
+// priceJourneys prices every journey using a pool of workers, keeping results in input order
+func priceJourneys(journeys []*BatchJourney, workers int, price func(*BatchJourney) *BatchResult) *BatchReport {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]*BatchResult, len(journeys))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = price(journeys[i])
+			}
+		}()
+	}
+
+	for i := range journeys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &BatchReport{Results: results}
+	for _, r := range results {
+		if r.Error != "" {
+			report.Failed++
+			continue
+		}
+		report.Priced++
+		report.Total += r.PeriodPrice
+	}
+	report.Total = Round(report.Total, 0.01)
+
+	return report
+}
+
+// priceJourney looks up the cheapest season for a journey, recording any failure on the result
+func priceJourney(ctx context.Context, repo repository.DtdRepository, catalogue models.TicketCatalogue, j *BatchJourney) *BatchResult {
+
+	ctx, span := tracer.Start(ctx, "priceJourney", trace.WithAttributes(attribute.String("stc.employee_id", j.EmployeeID)))
+	defer span.End()
+
+	result := &BatchResult{BatchJourney: *j}
+
+	fail := func(err error) *BatchResult {
+		logger.Warn("unable to price journey", zap.String("employee", j.EmployeeID), zap.Error(err))
+		result.Error = err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return result
+	}
+
+	if j.Class != "1" && j.Class != "2" {
+		return fail(errors.Errorf("class must be 1 or 2, got %q", j.Class))
+	}
+
+	src, err := findStation(ctx, repo, j.From)
+	if err != nil {
+		return fail(errors.Wrapf(err, "finding station %s", j.From))
+	}
+	result.FromName = src.Description
+
+	dst, err := findStation(ctx, repo, j.To)
+	if err != nil {
+		return fail(errors.Wrapf(err, "finding station %s", j.To))
+	}
+	result.ToName = dst.Description
+
+	fares, err := GetFaresContext(ctx, &GetFaresConfig{
+		Repo:        repo,
+		FromStation: j.From,
+		ToStation:   j.To,
+		From:        src,
+		To:          dst,
+		Season:      true,
+		Class:       j.Class,
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	weekly := pickCommuteFares(fares, catalogue).weekly
+	if weekly == nil {
+		return fail(errors.Errorf("no season fares found between %s and %s", j.From, j.To))
+	}
+
+	seasons := calculateFares(weekly.AdultFare)
+	periodPrice, err := seasonPrice(seasons, j.Period)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.TicketCode = weekly.TicketCode
+	result.Weekly = seasons.WeeklyStd
+	result.Monthly = seasons.MonthlyStd
+	result.Annual = seasons.AnnualStd
+	result.PeriodPrice = periodPrice
+
+	return result
+}
+
+func writeBatchCSV(w io.Writer, report *BatchReport) error {
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(batchHeader); err != nil {
+		return err
+	}
+
+	money := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	for _, r := range report.Results {
+		row := []string{r.EmployeeID, r.From, r.To, r.Class, r.Period, r.FromName, r.ToName, r.TicketCode, "", "", "", "", r.Error}
+		if r.Error == "" {
+			row[8], row[9], row[10], row[11] = money(r.Weekly), money(r.Monthly), money(r.Annual), money(r.PeriodPrice)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func batch(ctx context.Context, input, output, format string, workers int) error {
+
+	if format != "csv" && format != "json" {
+		return errors.Errorf("unknown output format %q", format)
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	journeys, err := readJourneys(in)
+	if err != nil {
+		return err
+	}
+
+	repo, err := newRepositoryContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	report := priceJourneys(journeys, workers, func(j *BatchJourney) *BatchResult {
+		return priceJourney(ctx, repo, catalogue, j)
+	})
+
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = writeBatchCSV(out, report)
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing batch results")
+	}
+
+	fmt.Fprintf(os.Stderr, "Priced %d of %d journeys, total £%.2f\n", report.Priced, len(journeys), report.Total)
+
+	return nil
+}
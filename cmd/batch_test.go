@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+func Test_readJourneys(t *testing.T) {
+
+	input := "employee_id,from,to,class,period\n" +
+		"E1,snr,EGR,2,annual\n" +
+		"E2,VIC,BTN,,\n" +
+		"E3,VIC,BTN,1,90\n"
+
+	got, err := readJourneys(strings.NewReader(input))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*BatchJourney{
+		{EmployeeID: "E1", From: "SNR", To: "EGR", Class: "2", Period: "annual"},
+		{EmployeeID: "E2", From: "VIC", To: "BTN", Class: "2", Period: "annual"},
+		{EmployeeID: "E3", From: "VIC", To: "BTN", Class: "1", Period: "90"},
+	}, got)
+}
+
+func Test_priceJourneys(t *testing.T) {
+
+	journeys := []*BatchJourney{
+		{EmployeeID: "E1", From: "SNR", To: "EGR"},
+		{EmployeeID: "E2", From: "NOPE", To: "EGR"},
+		{EmployeeID: "E3", From: "VIC", To: "BTN"},
+	}
+
+	price := func(j *BatchJourney) *BatchResult {
+		r := &BatchResult{BatchJourney: *j}
+		if j.From == "NOPE" {
+			r.Error = errors.New("not found").Error()
+			return r
+		}
+		r.PeriodPrice = 1000.05
+		return r
+	}
+
+	report := priceJourneys(journeys, 2, price)
+
+	assert.Equal(t, 2, report.Priced)
+	assert.Equal(t, 1, report.Failed)
+	assert.InDelta(t, 2000.1, report.Total, 0.001)
+	for i, r := range report.Results {
+		assert.Equal(t, journeys[i].EmployeeID, r.EmployeeID)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeBatchCSV(&buf, report))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "E2,NOPE,EGR,,,,,,,,,,not found", lines[2])
+}
+
+// countingRepository counts the station lookups made through it
+type countingRepository struct {
+	*stubRepository
+	stationLookups int
+}
+
+func (r *countingRepository) WithContext(ctx context.Context) repository.DtdRepository {
+	return r
+}
+
+func (r *countingRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	r.stationLookups++
+	return &models.LocationWithGroups{CRS: crs, Description: crs + " STATION"}, nil
+}
+
+func Test_priceJourney(t *testing.T) {
+
+	repo := &countingRepository{stubRepository: &stubRepository{
+		fares: []*models.FareDetailExtreme{{TicketCode: "7DS", TicketType: "N", AdultFare: 5000}},
+	}}
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+	})
+
+	got := priceJourney(context.Background(), repo, catalogue, &BatchJourney{EmployeeID: "E1", From: "SNR", To: "EGR", Class: "2", Period: "weekly"})
+
+	assert.Empty(t, got.Error)
+	assert.Equal(t, "SNR STATION", got.FromName)
+	assert.Equal(t, "EGR STATION", got.ToName)
+	assert.Equal(t, "7DS", got.TicketCode)
+	assert.Equal(t, 50.0, got.PeriodPrice)
+	assert.Equal(t, 2, repo.stationLookups, "each station should only be looked up once")
+}
@@ -1,31 +1,41 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"os"
+	"strings"
 
 	"github.com/lensesio/tableprinter"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 
+	"github.com/jdheyburn/stc/cmd/geo"
 	"github.com/jdheyburn/stc/cmd/models"
 	"github.com/jdheyburn/stc/cmd/repository"
 )
 
-var logger, _ = zap.NewDevelopment()
 var fromStation, toStation string
 var season bool
+var includeTravelcard bool
+var rawFares bool
+var goldCard bool
+var suggestAlternativesN int
 
 func init() {
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	logger, _ = config.Build()
 	rootCmd.AddCommand(calcCmd)
 	calcCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code")
 	calcCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code")
 	calcCmd.Flags().BoolVarP(&season, "season", "s", false, "Whether to lookup season tickets only")
+	calcCmd.Flags().BoolVar(&includeTravelcard, "include-travelcard", false, "Include Travelcard seasons and compare them to point-to-point seasons")
+	calcCmd.Flags().BoolVar(&rawFares, "raw", false, "Show every fare rather than grouping equivalent smartcard and paper products")
+	calcCmd.Flags().BoolVar(&goldCard, "gold-card", false, "Apply the Gold Card discount to non-season fares and check the annual season qualifies")
+	calcCmd.Flags().IntVar(&suggestAlternativesN, "suggest-alternatives", 0, "Price seasons from the N stations nearest each end and show the savings")
 	calcCmd.MarkFlagRequired("from")
 	calcCmd.MarkFlagRequired("to")
 }
@@ -36,8 +46,12 @@ var calcCmd = &cobra.Command{
 	Long:  `TBC`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Debug("Arguments", zap.String("from", fromStation), zap.String("to", toStation), zap.Bool("season", season))
-		if err := calc(fromStation, toStation, season); err != nil {
+		ctx, span := tracer.Start(cmd.Context(), "calc")
+		err := calc(ctx, fromStation, toStation, season, includeTravelcard, rawFares, goldCard, suggestAlternativesN)
+		endSpan(span, err)
+		if err != nil {
 			logger.Error("error running calc", zap.Error(err))
+			shutdownTracing(ctx)
 			os.Exit(1)
 		}
 	},
@@ -76,34 +90,56 @@ func calculateFares(weeklyFare uint) *Fares {
 }
 
 type GetFaresConfig struct {
-	Repo        *repository.DtdRepositorySql
+	Repo        repository.DtdRepository
 	FromStation string
 	ToStation   string
 	Season      bool
 	Class       string
+	// From and To are the stations when the caller has already found them, saving looking them up again
+	From *models.LocationWithGroups `json:"-"`
+	To   *models.LocationWithGroups `json:"-"`
 }
 
 func GetFares(cfg *GetFaresConfig) ([]*models.FareDetailExtreme, error) {
+	return GetFaresContext(context.Background(), cfg)
+}
+
+// GetFaresContext is GetFares with each step traced as a child of any span in ctx
+func GetFaresContext(ctx context.Context, cfg *GetFaresConfig) (fares []*models.FareDetailExtreme, err error) {
+
+	ctx, span := tracer.Start(ctx, "GetFares", trace.WithAttributes(
+		attribute.String("stc.from_crs", cfg.FromStation),
+		attribute.String("stc.to_crs", cfg.ToStation),
+		attribute.String("stc.class", cfg.Class),
+		attribute.Bool("stc.season", cfg.Season),
+	))
+	defer func() { endSpan(span, err) }()
 
 	logger.Info("searching for fares with config", zap.Any("cfg", cfg))
 
-	src, err := cfg.Repo.FindStationsByCrs(cfg.FromStation)
+	src := cfg.From
+	if src == nil {
+		src, err = findStation(ctx, cfg.Repo, cfg.FromStation)
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "finding stations for source crs")
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding stations for source crs")
+		}
+
+		logger.Debug("found station for crs", zap.String("crs", cfg.FromStation), zap.Any("station", src))
 	}
 
-	logger.Debug("found station for crs", zap.String("crs", cfg.FromStation), zap.Any("station", src))
+	dst := cfg.To
+	if dst == nil {
+		dst, err = findStation(ctx, cfg.Repo, cfg.ToStation)
 
-	dst, err := cfg.Repo.FindStationsByCrs(cfg.ToStation)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding stations for destination crs")
+		}
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "finding stations for destination crs")
+		logger.Debug("found station for crs", zap.String("crs", cfg.ToStation), zap.Any("station", dst))
 	}
 
-	logger.Debug("found station for crs", zap.String("crs", cfg.ToStation), zap.Any("station", src))
-
-	srcNlcs, err := cfg.Repo.FindNLCsRelatedToCrs(src[0].CRS)
+	srcNlcs, err := findRelatedNLCs(ctx, cfg.Repo, src.CRS)
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "finding NLCs related to source CRS")
@@ -111,7 +147,7 @@ func GetFares(cfg *GetFaresConfig) ([]*models.FareDetailExtreme, error) {
 
 	logger.Debug("found NLCs related to crs", zap.String("crs", cfg.FromStation), zap.Any("nlcs", srcNlcs))
 
-	dstNlcs, err := cfg.Repo.FindNLCsRelatedToCrs(dst[0].CRS)
+	dstNlcs, err := findRelatedNLCs(ctx, cfg.Repo, dst.CRS)
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "finding NLCs related to destination CRS")
@@ -119,7 +155,11 @@ func GetFares(cfg *GetFaresConfig) ([]*models.FareDetailExtreme, error) {
 
 	logger.Debug("found NLCs related to crs", zap.String("crs", cfg.ToStation), zap.Any("nlcs", dstNlcs))
 
-	fares, err := cfg.Repo.FindFaresForNLCs(srcNlcs, dstNlcs, cfg.Season, cfg.Class)
+	span.SetAttributes(attribute.Int("stc.src_nlcs", len(srcNlcs)), attribute.Int("stc.dst_nlcs", len(dstNlcs)))
+
+	fares, err = findFares(ctx, cfg.Repo, "FindFaresForNLCs", len(srcNlcs), len(dstNlcs), func(repo repository.DtdRepository) ([]*models.FareDetailExtreme, error) {
+		return repo.FindFaresForNLCs(models.NLCCodes(srcNlcs), models.NLCCodes(dstNlcs), cfg.Season, cfg.Class)
+	})
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "finding fares for src and dst NLCs")
@@ -129,7 +169,9 @@ func GetFares(cfg *GetFaresConfig) ([]*models.FareDetailExtreme, error) {
 
 	if !cfg.Season {
 		logger.Info("season ticket not specified, retrieving fare overrides")
-		overrides, err := cfg.Repo.FindFareOverridesForNLCs(srcNlcs, dstNlcs)
+		overrides, err := findFares(ctx, cfg.Repo, "FindFareOverridesForNLCs", len(srcNlcs), len(dstNlcs), func(repo repository.DtdRepository) ([]*models.FareDetailExtreme, error) {
+			return repo.FindFareOverridesForNLCs(models.NLCCodes(srcNlcs), models.NLCCodes(dstNlcs))
+		})
 		if err != nil {
 			return nil, errors.Wrapf(err, "retrieving fare overrides")
 		}
@@ -141,36 +183,205 @@ func GetFares(cfg *GetFaresConfig) ([]*models.FareDetailExtreme, error) {
 		}
 	}
 
+	annotateProvenance(fares, srcNlcs, dstNlcs)
+
+	span.SetAttributes(attribute.Int("stc.fares", len(fares)))
+
 	return fares, nil
 }
 
-// Kinda using this just for testing locally atm
-func calc(fromStation, toStation string, season bool) error {
+// findStation looks up a station and its groups in its own span
+func findStation(ctx context.Context, repo repository.DtdRepository, crs string) (station *models.LocationWithGroups, err error) {
+	ctx, span := tracer.Start(ctx, "FindStationWithGroupsByCrs", trace.WithAttributes(attribute.String("stc.crs", crs)))
+	defer func() { endSpan(span, err) }()
+	return repo.WithContext(ctx).FindStationWithGroupsByCrs(crs)
+}
 
-	opts := &repository.DtdSqlDBOptions{
-		User:     "root",
-		Password: "password123",
-		Host:     "localhost",
-		Port:     "3306",
-		DBName:   "fares",
+// findRelatedNLCs looks up the NLCs a station is priced from in its own span, recording how many
+// there were since big groups such as London Terminals are what make fare lookups slow
+func findRelatedNLCs(ctx context.Context, repo repository.DtdRepository, crs string) (nlcs []*models.RelatedNLC, err error) {
+	ctx, span := tracer.Start(ctx, "FindNLCsRelatedToCrs", trace.WithAttributes(attribute.String("stc.crs", crs)))
+	defer func() { endSpan(span, err) }()
+	nlcs, err = repo.WithContext(ctx).FindNLCsRelatedToCrs(crs)
+	span.SetAttributes(attribute.Int("stc.nlcs", len(nlcs)))
+	return nlcs, err
+}
+
+// findFares runs a fares lookup in its own span, recording the NLCs searched and rows found
+func findFares(ctx context.Context, repo repository.DtdRepository, name string, srcNlcs, dstNlcs int, find func(repository.DtdRepository) ([]*models.FareDetailExtreme, error)) (fares []*models.FareDetailExtreme, err error) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.Int("stc.src_nlcs", srcNlcs),
+		attribute.Int("stc.dst_nlcs", dstNlcs),
+	))
+	defer func() { endSpan(span, err) }()
+	fares, err = find(repo.WithContext(ctx))
+	span.SetAttributes(attribute.Int("stc.rows", len(fares)))
+	return fares, err
+}
+
+// withoutTravelcards drops fares that include London Travelcard zones so only point-to-point fares remain
+func withoutTravelcards(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue) []*models.FareDetailExtreme {
+	var filtered []*models.FareDetailExtreme
+	for _, fare := range fares {
+		if !catalogue.Lookup(fare.TicketCode).IsTravelcard() {
+			filtered = append(filtered, fare)
+		}
 	}
-	repo, err := repository.NewDtdRepositorySql(opts)
+	return filtered
+}
+
+type travelcardComparison struct {
+	TicketCode       string  `header:"ticket_code"`
+	TicketDesc       string  `header:"tkt_desc"`
+	Weekly           float64 `header:"weekly"`
+	Annual           float64 `header:"annual"`
+	PointToPointCode string  `header:"p2p_ticket_code"`
+	PointToPointAnn  float64 `header:"p2p_annual"`
+	TravelcardExtra  float64 `header:"travelcard_extra"`
+}
+
+// compareTravelcards prices each Travelcard season against the cheapest point-to-point season
+func compareTravelcards(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue) []travelcardComparison {
+
+	var cheapest *models.FareDetailExtreme
+	for _, fare := range fares {
+		ticket := catalogue.Lookup(fare.TicketCode)
+		if !ticket.IsSeason() || ticket.IsTravelcard() {
+			continue
+		}
+		if cheapest == nil || fare.AdultFare < cheapest.AdultFare {
+			cheapest = fare
+		}
+	}
+
+	var rows []travelcardComparison
+	for _, fare := range fares {
+		ticket := catalogue.Lookup(fare.TicketCode)
+		if !ticket.IsSeason() || !ticket.IsTravelcard() {
+			continue
+		}
+		seasons := calculateFares(fare.AdultFare)
+		row := travelcardComparison{
+			TicketCode: fare.TicketCode,
+			TicketDesc: fare.TicketDesc,
+			Weekly:     seasons.WeeklyStd,
+			Annual:     seasons.AnnualStd,
+		}
+		if cheapest != nil {
+			p2p := calculateFares(cheapest.AdultFare)
+			row.PointToPointCode = cheapest.TicketCode
+			row.PointToPointAnn = p2p.AnnualStd
+			row.TravelcardExtra = Round(seasons.AnnualStd-p2p.AnnualStd, 0.01)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// annotateProvenance records which rule linked each end of a fare to the requested stations,
+// so that fares priced from a group or cluster are not mistaken for the station itself
+func annotateProvenance(fares []*models.FareDetailExtreme, srcNlcs, dstNlcs []*models.RelatedNLC) {
+
+	src := models.NLCSources(srcNlcs)
+	dst := models.NLCSources(dstNlcs)
+
+	for _, fare := range fares {
+		// Reversible flows can be stored in the opposite direction to the search
+		if via, ok := src[fare.OriginCode]; ok {
+			fare.OriginVia = via
+			fare.DestinationVia = dst[fare.DestinationCode]
+		} else {
+			fare.OriginVia = dst[fare.OriginCode]
+			fare.DestinationVia = src[fare.DestinationCode]
+		}
+	}
+}
+
+// Kinda using this just for testing locally atm
+func calc(ctx context.Context, fromStation, toStation string, season, includeTravelcard, raw, goldCard bool, alternatives int) error {
+
+	repo, err := newRepositoryContext(ctx)
 	if err != nil {
 		panic(err)
 	}
 
 	cfg := &GetFaresConfig{
 		Repo:        repo,
-		FromStation: fromStation,
-		ToStation:   toStation,
+		FromStation: strings.ToUpper(fromStation),
+		ToStation:   strings.ToUpper(toStation),
 		Season:      season,
 		Class:       "2",
 	}
 
-	fares, err := GetFares(cfg)
+	fares, err := GetFaresContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	// Travelcards are only shown when asked for, so they can be compared with point-to-point seasons
+	if !includeTravelcard {
+		fares = withoutTravelcards(fares, catalogue)
+	}
+
+	if goldCard {
+		applyGoldCard(fares, catalogue, viper.GetFloat64("goldcard.discount"))
+	}
 
 	printer := tableprinter.New(os.Stdout)
-	printer.Print(fares)
+	if raw {
+		printer.Print(fares)
+	} else {
+		printer.Print(groupFares(fares, catalogue))
+	}
+
+	if includeTravelcard {
+		for _, crs := range []string{cfg.FromStation, cfg.ToStation} {
+			zones, err := repo.FindZonesForCrs(crs)
+			if err != nil {
+				return errors.Wrapf(err, "finding zones for %s", crs)
+			}
+			printZones(zones)
+		}
+		printer.Print(compareTravelcards(fares, catalogue))
+	}
+
+	// Coordinates are optional so only show distances when both stations have them
+	if km, err := stationDistanceKm(repo, cfg.FromStation, cfg.ToStation); err != nil {
+		logger.Debug("skipping price per mile", zap.Error(err))
+	} else {
+		printer.Print(pricesPerMile(fares, catalogue, geo.Miles(km)))
+	}
+
+	if goldCard {
+		eligibility := goldCardEligibility(fares, catalogue, viper.GetStringSlice("goldcard.tocs"))
+		if eligibility.Qualifies {
+			fmt.Printf("Gold Card: yes, %s\n", eligibility.Reason)
+		} else {
+			fmt.Printf("Gold Card: no, %s\n", eligibility.Reason)
+		}
+	}
+
+	if alternatives > 0 {
+		suggestions, err := suggestAlternatives(ctx, repo, catalogue, cfg.FromStation, cfg.ToStation, cfg.Class, alternatives)
+		if err != nil {
+			return errors.Wrap(err, "suggesting alternatives")
+		}
+		// The fares already found include the requested pair's seasons, Travelcards aside
+		if weekly := pickCommuteFares(fares, catalogue).weekly; weekly != nil {
+			requested := calculateFares(weekly.AdultFare).AnnualStd
+			fmt.Printf("Alternatives to the %s to %s annual season at £%.2f\n", cfg.FromStation, cfg.ToStation, requested)
+			printer.Print(alternativeSavings(requested, suggestions))
+		} else {
+			fmt.Printf("No season from %s to %s to compare with, alternatives cheapest first\n", cfg.FromStation, cfg.ToStation)
+			printer.Print(suggestions)
+		}
+	}
 
 	return nil
 }
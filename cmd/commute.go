@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+const (
+	weeksPerMonth = 52.0 / 12
+	daysPerMonth  = 365.0 / 12
+	// A flexi season gives this many travel days within flexiPeriodDays
+	flexiTravelDays = 8
+	flexiPeriodDays = 28
+)
+
+var commuteDaysPerWeek float64
+
+func init() {
+	rootCmd.AddCommand(commuteCmd)
+	commuteCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code")
+	commuteCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code")
+	commuteCmd.Flags().Float64VarP(&commuteDaysPerWeek, "days", "d", 5, "Days per week travelled, e.g. 2.5")
+	commuteCmd.MarkFlagRequired("from")
+	commuteCmd.MarkFlagRequired("to")
+}
+
+var commuteCmd = &cobra.Command{
+	Use:   "commute",
+	Short: "Compare the monthly cost of day returns, flexi and full seasons",
+	Long: `Works out what a month of commuting costs for a travel pattern of some days per
+week, using anytime and off-peak day returns, flexi seasons, and weekly, monthly
+and annual seasons, and recommends the cheapest.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("Arguments", zap.String("from", fromStation), zap.String("to", toStation), zap.Float64("days", commuteDaysPerWeek))
+		if err := commute(cmd.Context(), strings.ToUpper(fromStation), strings.ToUpper(toStation), commuteDaysPerWeek); err != nil {
+			logger.Error("error running commute", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// CommuteOption is the cost of one way of buying tickets for a month of commuting
+type CommuteOption struct {
+	Option     string  `header:"option"`
+	TicketCode string  `header:"ticket_code"`
+	TicketDesc string  `header:"tkt_desc"`
+	Price      float64 `header:"ticket_price"`
+	Monthly    float64 `header:"monthly_cost"`
+	Notes      string  `header:"notes"`
+}
+
+// commuteFares are the cheapest fare of each kind useful for commuting
+type commuteFares struct {
+	anytimeReturn *models.FareDetailExtreme
+	offPeakReturn *models.FareDetailExtreme
+	flexi         *models.FareDetailExtreme
+	weekly        *models.FareDetailExtreme
+}
+
+func cheapest(current, candidate *models.FareDetailExtreme) *models.FareDetailExtreme {
+	if current == nil || candidate.AdultFare < current.AdultFare {
+		return candidate
+	}
+	return current
+}
+
+// pickCommuteFares finds the cheapest return, flexi and weekly season fares, ignoring Travelcards
+func pickCommuteFares(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue) *commuteFares {
+
+	picked := &commuteFares{}
+
+	for _, fare := range fares {
+		ticket := catalogue.ForFare(fare)
+		if ticket.IsTravelcard() {
+			continue
+		}
+
+		switch {
+		case ticket.IsFlexiSeason():
+			picked.flexi = cheapest(picked.flexi, fare)
+		case ticket.IsSeason():
+			picked.weekly = cheapest(picked.weekly, fare)
+		case fare.TicketType != models.TicketTypeReturn:
+			// Singles aren't used for commuting
+		case isOffPeak(ticket, fare):
+			picked.offPeakReturn = cheapest(picked.offPeakReturn, fare)
+		default:
+			picked.anytimeReturn = cheapest(picked.anytimeReturn, fare)
+		}
+	}
+
+	return picked
+}
+
+// isOffPeak classifies a fare by its ticket type, only falling back to whether the fare has a
+// restriction for tickets missing from the catalogue
+func isOffPeak(ticket *models.TicketTypeData, fare *models.FareDetailExtreme) bool {
+	if ticket.Description == "" {
+		return fare.RestrictionCode != ""
+	}
+	return ticket.IsOffPeak()
+}
+
+// commuteOptions prices a month of travel for each way of buying tickets, cheapest first
+func commuteOptions(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue, daysPerWeek float64) []*CommuteOption {
+
+	picked := pickCommuteFares(fares, catalogue)
+	travelDays := daysPerWeek * weeksPerMonth
+	var options []*CommuteOption
+
+	pounds := func(pence uint) float64 {
+		return float64(pence) / 100
+	}
+
+	option := func(name string, fare *models.FareDetailExtreme, monthly float64, notes string) *CommuteOption {
+		return &CommuteOption{
+			Option:     name,
+			TicketCode: fare.TicketCode,
+			TicketDesc: fare.TicketDesc,
+			Price:      pounds(fare.AdultFare),
+			Monthly:    Round(monthly, 0.01),
+			Notes:      notes,
+		}
+	}
+
+	if picked.anytimeReturn != nil {
+		options = append(options, option("anytime day returns", picked.anytimeReturn,
+			travelDays*pounds(picked.anytimeReturn.AdultFare), ""))
+	}
+
+	if picked.offPeakReturn != nil {
+		options = append(options, option("off-peak day returns", picked.offPeakReturn,
+			travelDays*pounds(picked.offPeakReturn.AdultFare), picked.offPeakReturn.RestrictionDesc))
+	}
+
+	if picked.flexi != nil {
+		// Days beyond the carnet allowance are topped up with the cheapest peak return,
+		// or the cheapest return of any kind where there's no peak one
+		periodDays := daysPerWeek * flexiPeriodDays / 7
+		periodCost := pounds(picked.flexi.AdultFare)
+		notes := fmt.Sprintf("%v days in %v", flexiTravelDays, flexiPeriodDays)
+		if extra := periodDays - flexiTravelDays; extra > 0 {
+			switch {
+			case picked.anytimeReturn != nil:
+				periodCost += extra * pounds(picked.anytimeReturn.AdultFare)
+				notes += fmt.Sprintf(" plus %.1f day returns", extra)
+			case picked.offPeakReturn != nil:
+				periodCost += extra * pounds(picked.offPeakReturn.AdultFare)
+				notes += fmt.Sprintf(" plus %.1f off-peak day returns", extra)
+			default:
+				notes += fmt.Sprintf(" with %.1f days not priced", extra)
+			}
+		}
+		options = append(options, option("flexi season", picked.flexi, periodCost*daysPerMonth/flexiPeriodDays, notes))
+	}
+
+	if picked.weekly != nil {
+		seasons := calculateFares(picked.weekly.AdultFare)
+		options = append(options,
+			option("weekly season", picked.weekly, seasons.WeeklyStd*weeksPerMonth, ""),
+			option("monthly season", picked.weekly, seasons.MonthlyStd, fmt.Sprintf("£%.2f per month", seasons.MonthlyStd)),
+			option("annual season", picked.weekly, seasons.AnnualStd/12, fmt.Sprintf("£%.2f per year", seasons.AnnualStd)),
+		)
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Monthly < options[j].Monthly
+	})
+
+	return options
+}
+
+func commute(ctx context.Context, fromStation, toStation string, daysPerWeek float64) error {
+
+	if daysPerWeek <= 0 || daysPerWeek > 7 {
+		return errors.Errorf("days per week must be between 0 and 7, got %v", daysPerWeek)
+	}
+
+	repo, err := newRepositoryContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	fares, err := GetFaresContext(ctx, &GetFaresConfig{
+		Repo:        repo,
+		FromStation: fromStation,
+		ToStation:   toStation,
+		Class:       "2",
+	})
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	options := commuteOptions(fares, catalogue, daysPerWeek)
+	if len(options) == 0 {
+		return errors.Errorf("no commuting fares found between %s and %s", fromStation, toStation)
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(options)
+
+	best := options[0]
+	fmt.Printf("\nTravelling %v days a week, %s is cheapest at £%.2f per month", daysPerWeek, best.Option, best.Monthly)
+	if len(options) > 1 {
+		fmt.Printf(", saving £%.2f on %s", math.Max(0, options[1].Monthly-best.Monthly), options[1].Option)
+	}
+	fmt.Println()
+
+	return nil
+}
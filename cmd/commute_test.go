@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_commuteOptions(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "SDR", Description: "ANYTIME DAY R", TktType: "R"},
+		{TicketCode: "CDR", Description: "OFF-PEAK DAY R", TktType: "R"},
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+		{TicketCode: "FSS", Description: "FLEXI SEASON", TktType: "N"},
+	})
+
+	fares := []*models.FareDetailExtreme{
+		{TicketCode: "SDR", TicketType: "R", AdultFare: 1620},
+		{TicketCode: "CDR", TicketType: "R", AdultFare: 950, RestrictionCode: "B1", RestrictionDesc: "OFF-PEAK"},
+		{TicketCode: "7DS", TicketType: "N", AdultFare: 5300},
+		{TicketCode: "FSS", TicketType: "N", AdultFare: 11000},
+	}
+
+	tests := []struct {
+		name        string
+		daysPerWeek float64
+		wantBest    string
+		wantMonthly map[string]float64
+	}{
+		{
+			name:        "should recommend day returns for one day a week",
+			daysPerWeek: 1,
+			wantBest:    "off-peak day returns",
+			wantMonthly: map[string]float64{
+				"anytime day returns": 70.2,
+				"flexi season":        119.49,
+				"monthly season":      203.5,
+			},
+		},
+		{
+			name:        "should price flexi below anytime returns for two days a week",
+			daysPerWeek: 2,
+			wantBest:    "off-peak day returns",
+			wantMonthly: map[string]float64{
+				"anytime day returns": 140.4,
+				"flexi season":        119.49,
+			},
+		},
+		{
+			name:        "should recommend a full season for five days a week",
+			daysPerWeek: 5,
+			wantBest:    "annual season",
+			wantMonthly: map[string]float64{
+				"weekly season":  229.67,
+				"monthly season": 203.5,
+				"annual season":  176.67,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := commuteOptions(fares, catalogue, tt.daysPerWeek)
+			assert.Len(t, got, 6)
+			assert.Equal(t, tt.wantBest, got[0].Option)
+			for _, option := range got {
+				if want, ok := tt.wantMonthly[option.Option]; ok {
+					assert.InDelta(t, want, option.Monthly, 0.01, option.Option)
+				}
+			}
+		})
+	}
+}
+
+func Test_pickCommuteFares_offPeak(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "SDR", Description: "ANYTIME DAY R", TktType: "R"},
+		{TicketCode: "SVR", Description: "SUPER OFF-PEAK R", TktType: "R"},
+	})
+
+	fares := []*models.FareDetailExtreme{
+		// Anytime returns can still carry a restriction code
+		{TicketCode: "SDR", TicketType: "R", AdultFare: 1620, RestrictionCode: "RE"},
+		{TicketCode: "SVR", TicketType: "R", AdultFare: 950},
+		// Not in the catalogue so classified by its restriction
+		{TicketCode: "XDR", TicketType: "R", AdultFare: 800, RestrictionCode: "B1"},
+	}
+
+	got := pickCommuteFares(fares, catalogue)
+
+	assert.Equal(t, "SDR", got.anytimeReturn.TicketCode)
+	assert.Equal(t, "XDR", got.offPeakReturn.TicketCode)
+}
+
+func Test_commuteOptions_flexiWithoutAnytimeReturn(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "CDR", Description: "OFF-PEAK DAY R", TktType: "R"},
+		{TicketCode: "FSS", Description: "FLEXI SEASON", TktType: "N"},
+	})
+
+	fares := []*models.FareDetailExtreme{
+		{TicketCode: "CDR", TicketType: "R", AdultFare: 950},
+		{TicketCode: "FSS", TicketType: "N", AdultFare: 11000},
+	}
+
+	got := commuteOptions(fares, catalogue, 3)
+
+	var flexi *CommuteOption
+	for _, option := range got {
+		if option.Option == "flexi season" {
+			flexi = option
+		}
+	}
+	if assert.NotNil(t, flexi) {
+		// 12 days in 28, 4 of them on off-peak returns
+		assert.InDelta(t, (110+4*9.5)*daysPerMonth/flexiPeriodDays, flexi.Monthly, 0.01)
+		assert.Equal(t, "8 days in 28 plus 4.0 off-peak day returns", flexi.Notes)
+	}
+}
@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Journeys a season is deemed to cover when working out its value per journey,
+// as the National Rail Conditions of Travel do for Delay Repay
+var seasonJourneys = map[string]float64{
+	PeriodWeekly:      10,
+	PeriodMonthly:     40,
+	PeriodThreeMonths: 120,
+	PeriodSixMonths:   240,
+	PeriodAnnual:      464,
+}
+
+// defaultDelayRepayRules are used when no rules file is configured, built in so stc works
+// from any directory
+const defaultDelayRepayRules = `{
+  "default": {
+    "scheme": "Delay Repay 15",
+    "bands": [
+      { "min_minutes": 15, "percent": 25 },
+      { "min_minutes": 30, "percent": 50 },
+      { "min_minutes": 60, "percent": 100 },
+      { "min_minutes": 120, "percent": 100, "of_return": true }
+    ]
+  },
+  "tocs": {
+    "CHI": {
+      "scheme": "Delay Repay 30",
+      "bands": [
+        { "min_minutes": 30, "percent": 50 },
+        { "min_minutes": 60, "percent": 100 },
+        { "min_minutes": 120, "percent": 100, "of_return": true }
+      ]
+    },
+    "NIR": {
+      "scheme": "Delay Repay 30",
+      "bands": [
+        { "min_minutes": 30, "percent": 50 },
+        { "min_minutes": 60, "percent": 100 },
+        { "min_minutes": 120, "percent": 100, "of_return": true }
+      ]
+    }
+  }
+}`
+
+var (
+	compensationPrice  float64
+	compensationPeriod string
+	compensationClass  string
+	compensationTOC    string
+	compensationDelays string
+	compensationRules  string
+)
+
+func init() {
+	viper.SetDefault("compensation.rules", "")
+
+	rootCmd.AddCommand(compensationCmd)
+	compensationCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code, to price the season")
+	compensationCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code, to price the season")
+	compensationCmd.Flags().StringVarP(&compensationClass, "class", "c", "2", "Class of the season when priced from stations")
+	compensationCmd.Flags().Float64Var(&compensationPrice, "price", 0, "Price paid for the season in pounds, instead of --from and --to")
+	compensationCmd.Flags().StringVar(&compensationPeriod, "period", PeriodAnnual, "Season period: weekly, monthly, 3-monthly, 6-monthly, annual or a number of days")
+	compensationCmd.Flags().StringVar(&compensationTOC, "toc", "", "TOC whose Delay Repay scheme applies, defaults to the season fare's TOC")
+	compensationCmd.Flags().StringVarP(&compensationDelays, "delays", "d", "", "CSV of date,delay_minutes[,toc] rows")
+	compensationCmd.Flags().StringVar(&compensationRules, "rules", "", "Delay Repay rules file, relative paths in the config file are from its directory (default built-in rules)")
+	viper.BindPFlag("compensation.rules", compensationCmd.Flags().Lookup("rules"))
+	compensationCmd.MarkFlagRequired("delays")
+}
+
+var compensationCmd = &cobra.Command{
+	Use:   "compensation",
+	Short: "Estimate Delay Repay compensation for journeys made on a season ticket",
+	Long: `Works out the value of a single journey on a season ticket from its price
+and period, then applies the Delay Repay bands of the TOC operating each delayed
+journey. TOC schemes are read from a JSON rules file, with a default scheme used
+for any TOC not listed. Without compensation.rules or --rules the built-in rules
+are used. A relative compensation.rules in the config file is resolved from the
+config file's directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := compensation(cmd.Context()); err != nil {
+			logger.Error("error running compensation", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// DelayRepayBand pays a percentage of the single, or return, journey value for delays
+// of at least MinMinutes
+type DelayRepayBand struct {
+	MinMinutes int     `json:"min_minutes"`
+	Percent    float64 `json:"percent"`
+	OfReturn   bool    `json:"of_return"`
+}
+
+// DelayRepayScheme is the set of bands a TOC compensates delays under
+type DelayRepayScheme struct {
+	Scheme string            `json:"scheme"`
+	Bands  []*DelayRepayBand `json:"bands"`
+}
+
+// DelayRepayRules holds the default scheme and any TOC specific ones
+type DelayRepayRules struct {
+	Default *DelayRepayScheme            `json:"default"`
+	TOCs    map[string]*DelayRepayScheme `json:"tocs"`
+}
+
+// DelayedJourney is a single journey that arrived late
+type DelayedJourney struct {
+	Date    string
+	Minutes int
+	TOC     string
+}
+
+// Compensation is what is due for a DelayedJourney
+type Compensation struct {
+	Date    string  `header:"date"`
+	TOC     string  `header:"toc"`
+	Minutes int     `header:"delay_minutes"`
+	Scheme  string  `header:"scheme"`
+	Percent float64 `header:"percent"`
+	Amount  float64 `header:"compensation"`
+}
+
+// findDelayRepayRules loads the configured rules file, or the built-in rules when none is set
+func findDelayRepayRules() (*DelayRepayRules, error) {
+
+	path := delayRepayRulesPath(viper.ConfigFileUsed())
+	if path == "" {
+		return loadDelayRepayRules(strings.NewReader(defaultDelayRepayRules))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening delay repay rules")
+	}
+	defer f.Close()
+
+	return loadDelayRepayRules(f)
+}
+
+// delayRepayRulesPath resolves a relative rules path from the directory of configFile,
+// unless it was given with --rules in which case it's relative to the working directory
+func delayRepayRulesPath(configFile string) string {
+
+	path := viper.GetString("compensation.rules")
+	if path == "" || filepath.IsAbs(path) || compensationRules != "" || configFile == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(configFile), path)
+}
+
+// loadDelayRepayRules reads the rules file and sorts each scheme's bands by delay
+func loadDelayRepayRules(r io.Reader) (*DelayRepayRules, error) {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading delay repay rules")
+	}
+
+	var rules DelayRepayRules
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, errors.Wrap(err, "parsing delay repay rules")
+	}
+
+	if rules.Default == nil {
+		return nil, errors.New("delay repay rules need a default scheme")
+	}
+
+	schemes := []*DelayRepayScheme{rules.Default}
+	normalised := make(map[string]*DelayRepayScheme, len(rules.TOCs))
+	for toc, scheme := range rules.TOCs {
+		normalised[strings.ToUpper(toc)] = scheme
+		schemes = append(schemes, scheme)
+	}
+	rules.TOCs = normalised
+
+	for _, scheme := range schemes {
+		sort.Slice(scheme.Bands, func(i, j int) bool {
+			return scheme.Bands[i].MinMinutes < scheme.Bands[j].MinMinutes
+		})
+	}
+
+	return &rules, nil
+}
+
+// schemeFor returns the scheme a TOC runs, falling back to the default
+func (r *DelayRepayRules) schemeFor(toc string) *DelayRepayScheme {
+	if scheme, ok := r.TOCs[strings.ToUpper(toc)]; ok {
+		return scheme
+	}
+	return r.Default
+}
+
+// band returns the highest band the delay reaches, or nil if it is too short to claim
+func (s *DelayRepayScheme) band(minutes int) *DelayRepayBand {
+	var matched *DelayRepayBand
+	for _, band := range s.Bands {
+		if minutes >= band.MinMinutes {
+			matched = band
+		}
+	}
+	return matched
+}
+
+// journeyValue is the value of a single journey on a season ticket
+func journeyValue(price float64, period string) (float64, error) {
+
+	p, err := parseSeasonPeriod(period)
+	if err != nil {
+		return 0, err
+	}
+
+	if journeys, ok := seasonJourneys[p.name]; ok {
+		return price / journeys, nil
+	}
+
+	// Custom periods cover the same number of journeys per day as an annual season
+	return price / (float64(p.days) * seasonJourneys[PeriodAnnual] / 365), nil
+}
+
+// calculateCompensation applies the rules to each delayed journey, using defaultTOC for
+// journeys that don't name the TOC they were delayed on
+func calculateCompensation(rules *DelayRepayRules, value float64, defaultTOC string, delays []*DelayedJourney) []*Compensation {
+
+	var results []*Compensation
+	for _, delay := range delays {
+		toc := delay.TOC
+		if toc == "" {
+			toc = defaultTOC
+		}
+
+		scheme := rules.schemeFor(toc)
+		c := &Compensation{
+			Date:    delay.Date,
+			TOC:     toc,
+			Minutes: delay.Minutes,
+			Scheme:  scheme.Scheme,
+		}
+
+		if band := scheme.band(delay.Minutes); band != nil {
+			c.Percent = band.Percent
+			amount := value * band.Percent / 100
+			if band.OfReturn {
+				amount *= 2
+			}
+			c.Amount = Round(amount, 0.01)
+		}
+
+		results = append(results, c)
+	}
+
+	return results
+}
+
+// readDelays parses the delays CSV, skipping a header row if there is one
+func readDelays(r io.Reader) ([]*DelayedJourney, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading delays csv")
+	}
+
+	var delays []*DelayedJourney
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, errors.Errorf("line %d: expected at least date,delay_minutes", i+1)
+		}
+		minutes, err := strconv.Atoi(record[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d: invalid delay minutes", i+1)
+		}
+		d := &DelayedJourney{Date: record[0], Minutes: minutes}
+		if len(record) > 2 {
+			d.TOC = strings.ToUpper(record[2])
+		}
+		delays = append(delays, d)
+	}
+
+	return delays, nil
+}
+
+func compensation(ctx context.Context) error {
+
+	price := compensationPrice
+	toc := strings.ToUpper(compensationTOC)
+
+	switch {
+	case fromStation != "" && toStation != "":
+		repo, err := newRepositoryContext(ctx)
+		if err != nil {
+			return err
+		}
+		catalogue, err := findTicketCatalogue(repo)
+		if err != nil {
+			return errors.Wrapf(err, "finding ticket types")
+		}
+		weekly, err := cheapestSeasonFare(ctx, repo, catalogue, strings.ToUpper(fromStation), strings.ToUpper(toStation), compensationClass)
+		if err != nil {
+			return err
+		}
+		if price, err = seasonPrice(calculateFares(weekly.AdultFare), compensationPeriod); err != nil {
+			return err
+		}
+		if toc == "" {
+			toc = weekly.TOC
+		}
+	case compensationPrice <= 0:
+		return errors.New("either --price or both --from and --to are required")
+	}
+
+	value, err := journeyValue(price, compensationPeriod)
+	if err != nil {
+		return err
+	}
+
+	rules, err := findDelayRepayRules()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(compensationDelays)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	delays, err := readDelays(in)
+	if err != nil {
+		return err
+	}
+
+	results := calculateCompensation(rules, value, toc, delays)
+
+	total := 0.0
+	for _, c := range results {
+		total += c.Amount
+	}
+
+	fmt.Printf("Season:         %s at £%.2f\n", compensationPeriod, price)
+	fmt.Printf("Journey value:  £%.2f single, £%.2f daily\n", value, value*2)
+	tableprinter.New(os.Stdout).Print(results)
+	fmt.Printf("Total due:      £%.2f\n", Round(total, 0.01))
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDelayRepayRules = `{
+  "default": {
+    "scheme": "Delay Repay 15",
+    "bands": [
+      { "min_minutes": 120, "percent": 100, "of_return": true },
+      { "min_minutes": 15, "percent": 25 },
+      { "min_minutes": 30, "percent": 50 },
+      { "min_minutes": 60, "percent": 100 }
+    ]
+  },
+  "tocs": {
+    "chi": {
+      "scheme": "Delay Repay 30",
+      "bands": [
+        { "min_minutes": 30, "percent": 50 },
+        { "min_minutes": 60, "percent": 100 }
+      ]
+    }
+  }
+}`
+
+func Test_journeyValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		price   float64
+		period  string
+		want    float64
+		wantErr bool
+	}{
+		{"should divide an annual season by 464 journeys", 4640, PeriodAnnual, 10, false},
+		{"should divide a monthly season by 40 journeys", 400, PeriodMonthly, 10, false},
+		{"should pro rata custom periods against an annual season", 365, "100", 365 / (100 * 464.0 / 365), false},
+		{"should accept period aliases", 4640, "year", 10, false},
+		{"should value 7 days as a weekly season", 100, "7", 10, false},
+		{"should reject an unknown period", 100, "fortnightly", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := journeyValue(tt.price, tt.period)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 0.0001)
+		})
+	}
+}
+
+func Test_calculateCompensation(t *testing.T) {
+
+	rules, err := loadDelayRepayRules(strings.NewReader(testDelayRepayRules))
+	assert.NoError(t, err)
+
+	delays, err := readDelays(strings.NewReader("date,delay_minutes,toc\n2021-01-04,10\n2021-01-05,20\n2021-01-06,45\n2021-01-07,75\n2021-01-08,130\n2021-01-11,20,CHI\n2021-01-12,45,chi\n"))
+	assert.NoError(t, err)
+
+	got := calculateCompensation(rules, 10, "SWT", delays)
+
+	want := []float64{0, 2.5, 5, 10, 20, 0, 5}
+	for i, c := range got {
+		assert.Equal(t, want[i], c.Amount, "delay on %s", c.Date)
+	}
+	assert.Equal(t, "Delay Repay 15", got[0].Scheme)
+	assert.Equal(t, "SWT", got[0].TOC)
+	assert.Equal(t, "Delay Repay 30", got[6].Scheme)
+}
+
+func Test_findDelayRepayRules_default(t *testing.T) {
+
+	rules, err := findDelayRepayRules()
+	assert.NoError(t, err)
+	assert.Equal(t, "Delay Repay 15", rules.Default.Scheme)
+	assert.Equal(t, "Delay Repay 30", rules.TOCs["CHI"].Scheme)
+}
+
+func Test_delayRepayRulesPath(t *testing.T) {
+
+	defer viper.Set("compensation.rules", "")
+
+	tests := []struct {
+		name   string
+		config string
+		rules  string
+		want   string
+	}{
+		{"unset", "/etc/stc/stc.yaml", "", ""},
+		{"relative to config", "/etc/stc/stc.yaml", "delay_repay.json", "/etc/stc/delay_repay.json"},
+		{"absolute", "/etc/stc/stc.yaml", "/opt/delay_repay.json", "/opt/delay_repay.json"},
+		{"no config file", "", "delay_repay.json", "delay_repay.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("compensation.rules", tt.rules)
+			assert.Equal(t, tt.want, delayRepayRulesPath(tt.config))
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var forceActivate bool
+
+func init() {
+	dbCmd.AddCommand(datasetsCmd)
+	datasetsCmd.AddCommand(datasetsListCmd)
+	datasetsCmd.AddCommand(datasetsActivateCmd)
+	datasetsActivateCmd.Flags().BoolVar(&forceActivate, "force", false, "Activate even if integrity checks fail")
+	datasetsCmd.AddCommand(datasetsRollbackCmd)
+	datasetsCmd.AddCommand(datasetsDropCmd)
+}
+
+var datasetsCmd = &cobra.Command{
+	Use:   "datasets",
+	Short: "Manage staged and active fares datasets",
+}
+
+var datasetsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List fares datasets",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listDatasets(cmd.Context()); err != nil {
+			logger.Error("error listing datasets", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var datasetsActivateCmd = &cobra.Command{
+	Use:   "activate <id>",
+	Short: "Validate a dataset and swap it in as the live fares tables",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := activateDataset(cmd.Context(), args[0]); err != nil {
+			logger.Error("error activating dataset", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var datasetsRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Reactivate the previously active dataset",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rollbackDataset(cmd.Context()); err != nil {
+			logger.Error("error rolling back dataset", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var datasetsDropCmd = &cobra.Command{
+	Use:   "drop <id>",
+	Short: "Drop an inactive dataset and its tables",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := dropDataset(cmd.Context(), args[0]); err != nil {
+			logger.Error("error dropping dataset", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+type datasetRow struct {
+	ID          uint   `header:"id"`
+	Name        string `header:"name"`
+	Sequence    int    `header:"sequence"`
+	Status      string `header:"status"`
+	CreatedAt   string `header:"created_at"`
+	ActivatedAt string `header:"activated_at"`
+}
+
+func parseDatasetID(arg string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid dataset id %q", arg)
+	}
+	return uint(id), nil
+}
+
+func listDatasets(ctx context.Context) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	datasets, err := repo.FindDatasets(ctx)
+	if err != nil {
+		return err
+	}
+
+	var rows []datasetRow
+	for _, ds := range datasets {
+		row := datasetRow{
+			ID:        ds.ID,
+			Name:      ds.Name,
+			Sequence:  ds.Sequence,
+			Status:    ds.Status,
+			CreatedAt: ds.CreatedAt.Format("2006-01-02 15:04"),
+		}
+		if ds.ActivatedAt != nil {
+			row.ActivatedAt = ds.ActivatedAt.Format("2006-01-02 15:04")
+		}
+		rows = append(rows, row)
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(rows)
+
+	return nil
+}
+
+func activateDataset(ctx context.Context, arg string) error {
+
+	id, err := parseDatasetID(arg)
+	if err != nil {
+		return err
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	if err := repo.ActivateDataset(ctx, id, forceActivate); err != nil {
+		return err
+	}
+
+	fmt.Printf("Dataset %v is now active\n", id)
+
+	return nil
+}
+
+func rollbackDataset(ctx context.Context) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	ds, err := repo.RollbackDataset(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolled back to dataset %v (%s)\n", ds.ID, ds.Name)
+
+	return nil
+}
+
+func dropDataset(ctx context.Context, arg string) error {
+
+	id, err := parseDatasetID(arg)
+	if err != nil {
+		return err
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DropDataset(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("Dropped dataset %v\n", id)
+
+	return nil
+}
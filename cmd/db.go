@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/feed"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var stageImport bool
+var datasetName string
+var archiveImport bool
+
+func init() {
+	viper.SetDefault("db.user", "root")
+	viper.SetDefault("db.password", "password123")
+	viper.SetDefault("db.host", "localhost")
+	viper.SetDefault("db.port", "3306")
+	viper.SetDefault("db.name", "fares")
+	// Zero leaves lookups bounded only by the command or request running them
+	viper.SetDefault("db.query_timeout", time.Duration(0))
+
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbImportCmd)
+	dbImportCmd.Flags().BoolVar(&stageImport, "stage", false, "Load a full refresh into a new dataset instead of the live tables")
+	dbImportCmd.Flags().StringVar(&datasetName, "name", "", "Name of the staged dataset, such as the fares round")
+	dbImportCmd.Flags().BoolVar(&archiveImport, "archive", false, "Archive the fares into the history once applied to the live tables")
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the fares database",
+}
+
+var dbImportCmd = &cobra.Command{
+	Use:   "import <feed dir>",
+	Short: "Apply a full refresh or changes-only fares feed",
+	Long: `Applies the FFL, LOC and NFO files of a fares feed to the flow, fare, location
+and non_derivable_fare_override tables. Changes-only feeds must follow on from
+the last applied sequence number, and full refreshes must be newer than it.
+
+With --stage a full refresh is loaded into a new dataset which can be activated
+with "stc db datasets activate" once it has been checked.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("Arguments", zap.String("dir", args[0]))
+		if err := importFeed(cmd.Context(), args[0]); err != nil {
+			logger.Error("error importing feed", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// newRepository connects to the fares database using the db.* config values
+func newRepository() (*repository.DtdRepositorySql, error) {
+	opts := &repository.DtdSqlDBOptions{
+		User:               viper.GetString("db.user"),
+		Password:           viper.GetString("db.password"),
+		Host:               viper.GetString("db.host"),
+		Port:               viper.GetString("db.port"),
+		DBName:             viper.GetString("db.name"),
+		QueryTimeout:       viper.GetDuration("db.query_timeout"),
+		Logger:             logger,
+		SlowQueryThreshold: viper.GetDuration("log.slow_query"),
+	}
+	return repository.NewDtdRepositorySql(opts)
+}
+
+// newRepositoryContext connects to the fares database with every lookup made under ctx, so
+// a command's deadline and cancellation cover all of its queries
+func newRepositoryContext(ctx context.Context) (repository.DtdRepository, error) {
+	repo, err := newRepository()
+	if err != nil {
+		return nil, err
+	}
+	return repo.WithContext(ctx), nil
+}
+
+func importFeed(ctx context.Context, dir string) error {
+
+	f, err := feed.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("loaded feed",
+		zap.Int("sequence", f.Sequence),
+		zap.Bool("full", f.Full),
+		zap.Int("flows", len(f.Flows)),
+		zap.Int("fares", len(f.Fares)),
+		zap.Int("locations", len(f.Locations)),
+		zap.Int("overrides", len(f.Overrides)),
+	)
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	name := datasetName
+	if name == "" {
+		name = fmt.Sprintf("feed %03d", f.Sequence)
+	}
+
+	if !stageImport {
+		if err := repo.ApplyFeed(ctx, f); err != nil {
+			return err
+		}
+		if !archiveImport {
+			return nil
+		}
+		archived, err := repo.ArchiveFares(ctx, name, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Archived %d fares as round %s\n", archived, name)
+		return nil
+	}
+
+	ds, err := repo.StageFeed(ctx, f, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Staged feed %03d as dataset %v\n", f.Sequence, ds.ID)
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var (
+	diffFromDataset uint
+	diffToDataset   uint
+	diffFromDate    string
+	diffToDate      string
+	diffLimit       int
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().UintVar(&diffFromDataset, "from-dataset", 0, "Dataset to compare from (default the live tables)")
+	diffCmd.Flags().UintVar(&diffToDataset, "to-dataset", 0, "Dataset to compare to (default the live tables)")
+	diffCmd.Flags().StringVar(&diffFromDate, "from-date", "", "Date the old fares were valid on (YYYY-MM-DD, default today)")
+	diffCmd.Flags().StringVar(&diffToDate, "to-date", "", "Date the new fares were valid on (YYYY-MM-DD, default today)")
+	diffCmd.Flags().IntVarP(&diffLimit, "limit", "n", 20, "Rows to list for each kind of change, 0 for none")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Report what changed between two fares rounds",
+	Long: `Compares two fares rounds, either two datasets or the rows valid on two dates,
+and reports added, removed and changed flows, ticket types, routes and fare overrides
+along with changed fares by ticket code and the median change of changed fares by TOC.
+
+Ticket types and routes aren't kept per dataset, so they are only compared when
+the two rounds are in the same tables.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := diff(cmd.Context()); err != nil {
+			logger.Error("error running diff", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// DiffSummary counts the changes to one kind of row
+type DiffSummary struct {
+	Kind    string `header:"kind"`
+	Added   int    `header:"added"`
+	Removed int    `header:"removed"`
+	Changed int    `header:"changed"`
+}
+
+// FareChangeStats aggregates fare changes for a ticket code or TOC
+type FareChangeStats struct {
+	Key             string  `header:"key"`
+	Added           int     `header:"added"`
+	Removed         int     `header:"removed"`
+	Changed         int     `header:"changed"`
+	MedianOfChanged float64 `header:"median_of_changed_pct"`
+}
+
+func summariseDiff(kind string, rows []*models.FaresDiffRow) *DiffSummary {
+	s := &DiffSummary{Kind: kind}
+	for _, r := range rows {
+		switch r.ChangeType {
+		case models.DiffAdded:
+			s.Added++
+		case models.DiffRemoved:
+			s.Removed++
+		case models.DiffChanged:
+			s.Changed++
+		}
+	}
+	return s
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// fareChangeStats groups fare changes by key, taking the median percentage change of only the
+// fares that changed, so unchanged fares don't count towards it
+func fareChangeStats(rows []*models.FaresDiffRow, key func(*models.FaresDiffRow) string) []*FareChangeStats {
+
+	stats := map[string]*FareChangeStats{}
+	changes := map[string][]float64{}
+
+	for _, r := range rows {
+		k := key(r)
+		s, ok := stats[k]
+		if !ok {
+			s = &FareChangeStats{Key: k}
+			stats[k] = s
+		}
+		switch r.ChangeType {
+		case models.DiffAdded:
+			s.Added++
+		case models.DiffRemoved:
+			s.Removed++
+		case models.DiffChanged:
+			s.Changed++
+			if r.OldFare > 0 {
+				changes[k] = append(changes[k], (float64(r.NewFare)-float64(r.OldFare))/float64(r.OldFare)*100)
+			}
+		}
+	}
+
+	result := make([]*FareChangeStats, 0, len(stats))
+	for k, s := range stats {
+		s.MedianOfChanged = Round(median(changes[k]), 0.01)
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+func parseDiffDate(s, flag string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	d, err := time.Parse(planDateLayout, s)
+	return d, errors.Wrapf(err, "invalid %s", flag)
+}
+
+func printDiffRows(printer *tableprinter.Printer, title string, rows []*models.FaresDiffRow, limit int) {
+	if limit == 0 || len(rows) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d)\n", title, len(rows))
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	printer.Print(rows)
+}
+
+func diff(ctx context.Context) error {
+
+	fromDate, err := parseDiffDate(diffFromDate, "--from-date")
+	if err != nil {
+		return err
+	}
+
+	toDate, err := parseDiffDate(diffToDate, "--to-date")
+	if err != nil {
+		return err
+	}
+
+	from := repository.FaresSnapshot{Dataset: diffFromDataset, Date: fromDate}
+	to := repository.FaresSnapshot{Dataset: diffToDataset, Date: toDate}
+	if from == to {
+		return errors.New("nothing to compare, give two different datasets or dates")
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	d, err := repo.DiffFares(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	printer := tableprinter.New(os.Stdout)
+
+	compared := func(kind string) bool {
+		for _, k := range d.Unversioned {
+			if k == kind {
+				return false
+			}
+		}
+		return true
+	}
+
+	var summaries []*DiffSummary
+	for _, kind := range []struct {
+		name string
+		rows []*models.FaresDiffRow
+	}{
+		{"flows", d.Flows},
+		{"fares", d.Fares},
+		{"ticket types", d.TicketTypes},
+		{"routes", d.Routes},
+		{"fare overrides", d.Overrides},
+	} {
+		if compared(kind.name) {
+			summaries = append(summaries, summariseDiff(kind.name, kind.rows))
+		}
+	}
+	printer.Print(summaries)
+
+	if len(d.Unversioned) > 0 {
+		fmt.Printf("\nNot compared as datasets share their tables: %s\n", strings.Join(d.Unversioned, ", "))
+	}
+
+	if len(d.Fares) > 0 {
+		fmt.Println("\nFares by ticket code")
+		printer.Print(fareChangeStats(d.Fares, func(r *models.FaresDiffRow) string { return r.TicketCode }))
+
+		fmt.Println("\nFares by TOC")
+		printer.Print(fareChangeStats(d.Fares, func(r *models.FaresDiffRow) string { return r.TOC }))
+	}
+
+	printDiffRows(printer, "Flows", d.Flows, diffLimit)
+	printDiffRows(printer, "Ticket types", d.TicketTypes, diffLimit)
+	printDiffRows(printer, "Routes", d.Routes, diffLimit)
+	printDiffRows(printer, "Fare overrides", d.Overrides, diffLimit)
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_median(t *testing.T) {
+	assert.Equal(t, 0.0, median(nil))
+	assert.Equal(t, 2.0, median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 3, 2}))
+}
+
+func Test_fareChangeStats(t *testing.T) {
+
+	rows := []*models.FaresDiffRow{
+		{ChangeType: models.DiffChanged, TOC: "SWT", TicketCode: "7DS", OldFare: 5000, NewFare: 5100},
+		{ChangeType: models.DiffChanged, TOC: "SWT", TicketCode: "SDR", OldFare: 1000, NewFare: 1050},
+		{ChangeType: models.DiffChanged, TOC: "SWT", TicketCode: "SDS", OldFare: 1000, NewFare: 1010},
+		{ChangeType: models.DiffChanged, TOC: "SEC", TicketCode: "7DS", OldFare: 4000, NewFare: 3900},
+		{ChangeType: models.DiffAdded, TOC: "SEC", TicketCode: "7DS", NewFare: 3000},
+		{ChangeType: models.DiffRemoved, TOC: "SWT", TicketCode: "SDR", OldFare: 900},
+	}
+
+	byTOC := fareChangeStats(rows, func(r *models.FaresDiffRow) string { return r.TOC })
+
+	assert.Equal(t, []*FareChangeStats{
+		{Key: "SEC", Added: 1, Changed: 1, MedianOfChanged: -2.5},
+		{Key: "SWT", Removed: 1, Changed: 3, MedianOfChanged: 2},
+	}, byTOC)
+
+	byTicket := fareChangeStats(rows, func(r *models.FaresDiffRow) string { return r.TicketCode })
+
+	assert.Len(t, byTicket, 3)
+	assert.Equal(t, "7DS", byTicket[0].Key)
+	assert.Equal(t, -0.25, byTicket[0].MedianOfChanged)
+
+	summary := summariseDiff("fares", rows)
+	assert.Equal(t, &DiffSummary{Kind: "fares", Added: 1, Removed: 1, Changed: 4}, summary)
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var (
+	exploreClass     string
+	exploreMaxAnnual float64
+	exploreLimit     int
+)
+
+func init() {
+	rootCmd.AddCommand(exploreCmd)
+	exploreCmd.Flags().StringVarP(&toStation, "to", "t", "", "Workplace station CRS code")
+	exploreCmd.Flags().StringVarP(&exploreClass, "class", "c", "2", "Class of season to price")
+	exploreCmd.Flags().Float64Var(&exploreMaxAnnual, "max-annual", 0, "Only list origins with an annual season up to this price in pounds")
+	exploreCmd.Flags().IntVarP(&exploreLimit, "limit", "n", 0, "Maximum number of origins to list (default all)")
+	exploreCmd.MarkFlagRequired("to")
+}
+
+var exploreCmd = &cobra.Command{
+	Use:   "explore",
+	Short: "List where you can commute from to a station, cheapest season first",
+	Long: `Finds every flow into the workplace station, including flows to the groups
+and clusters it belongs to, prices the cheapest season from each origin and ranks
+them by annual season price.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := explore(strings.ToUpper(toStation), exploreClass, exploreMaxAnnual, exploreLimit); err != nil {
+			logger.Error("error running explore", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// ExploreResult is the cheapest season from one origin to the workplace
+type ExploreResult struct {
+	OriginNLC  string  `header:"origin_nlc"`
+	OriginName string  `header:"origin_name"`
+	ViaDest    string  `header:"destination_via"`
+	TicketCode string  `header:"ticket_code"`
+	TicketDesc string  `header:"tkt_desc"`
+	Weekly     float64 `header:"weekly"`
+	Monthly    float64 `header:"monthly"`
+	Annual     float64 `header:"annual"`
+}
+
+// exploreOrigins returns the NLC at the far end of each flow touching the destination NLCs,
+// only following flows that run towards the destination or are reversible
+func exploreOrigins(flows []*models.FlowDetail, dst map[string]string) []string {
+
+	seen := map[string]bool{}
+	var origins []string
+	add := func(nlc string) {
+		if _, ok := dst[nlc]; ok || seen[nlc] {
+			return
+		}
+		seen[nlc] = true
+		origins = append(origins, nlc)
+	}
+
+	for _, flow := range flows {
+		if _, ok := dst[flow.DestinationCode]; ok {
+			add(flow.OriginCode)
+		}
+		if _, ok := dst[flow.OriginCode]; ok && flow.Direction == "R" {
+			add(flow.DestinationCode)
+		}
+	}
+
+	sort.Strings(origins)
+	return origins
+}
+
+// rankOrigins keeps the cheapest season from each origin and orders them by price
+func rankOrigins(fares []*models.FareDetailExtreme, dst map[string]string, catalogue models.TicketCatalogue, names map[string]string, maxAnnual float64) []*ExploreResult {
+
+	cheapestFrom := map[string]*models.FareDetailExtreme{}
+	viaFrom := map[string]string{}
+	for _, fare := range fares {
+		if !catalogue.ForFare(fare).IsSeason() || catalogue.ForFare(fare).IsFlexiSeason() {
+			continue
+		}
+
+		// Reversible flows may be stored starting at the workplace
+		origin, via := fare.OriginCode, dst[fare.DestinationCode]
+		if v, ok := dst[fare.OriginCode]; ok {
+			origin, via = fare.DestinationCode, v
+		}
+
+		if current, ok := cheapestFrom[origin]; !ok || fare.AdultFare < current.AdultFare {
+			cheapestFrom[origin] = fare
+			viaFrom[origin] = via
+		}
+	}
+
+	var results []*ExploreResult
+	for origin, fare := range cheapestFrom {
+		seasons := calculateFares(fare.AdultFare)
+		if maxAnnual > 0 && seasons.AnnualStd > maxAnnual {
+			continue
+		}
+		name, ok := names[origin]
+		if !ok {
+			name = origin
+		}
+		results = append(results, &ExploreResult{
+			OriginNLC:  origin,
+			OriginName: name,
+			ViaDest:    viaFrom[origin],
+			TicketCode: fare.TicketCode,
+			TicketDesc: fare.TicketDesc,
+			Weekly:     seasons.WeeklyStd,
+			Monthly:    seasons.MonthlyStd,
+			Annual:     seasons.AnnualStd,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Annual != results[j].Annual {
+			return results[i].Annual < results[j].Annual
+		}
+		return results[i].OriginName < results[j].OriginName
+	})
+
+	return results
+}
+
+func explore(to, class string, maxAnnual float64, limit int) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	station, err := repo.FindStationWithGroupsByCrs(to)
+	if err != nil {
+		return errors.Wrapf(err, "finding station for crs")
+	}
+
+	dstNlcs, err := repo.FindNLCsRelatedToCrs(station.CRS)
+	if err != nil {
+		return errors.Wrapf(err, "finding NLCs related to destination CRS")
+	}
+
+	dst := models.NLCSources(dstNlcs)
+
+	var flows []*models.FlowDetail
+	for _, nlc := range dstNlcs {
+		found, err := repo.FindAllFlowsForStation(nlc.NLC)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		flows = append(flows, found...)
+	}
+
+	origins := exploreOrigins(flows, dst)
+	logger.Info("found origins with flows to destination", zap.String("crs", to), zap.Int("numOrigins", len(origins)))
+
+	if len(origins) == 0 {
+		return errors.Errorf("no flows found to %s", to)
+	}
+
+	fares, err := repo.FindFaresForNLCs(origins, models.NLCCodes(dstNlcs), true, class)
+	if err != nil {
+		return errors.Wrapf(err, "finding fares for origins")
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	names, err := repo.FindLocationNamesByNLCs(origins)
+	if err != nil {
+		return err
+	}
+
+	results := rankOrigins(withoutTravelcards(fares, catalogue), dst, catalogue, names, maxAnnual)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	fmt.Printf("Commuting to %s (%s): %d origins\n", station.Description, station.CRS, len(results))
+	tableprinter.New(os.Stdout).Print(results)
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exploreOrigins(t *testing.T) {
+
+	dst := map[string]string{"5143": models.NLCSourceStation, "1072": models.NLCSourceGroup}
+
+	flows := []*models.FlowDetail{
+		{OriginCode: "5598", DestinationCode: "5143", Direction: "S"},
+		{OriginCode: "5143", DestinationCode: "5565", Direction: "R"},
+		{OriginCode: "1072", DestinationCode: "5001", Direction: "S"},
+		{OriginCode: "5598", DestinationCode: "1072", Direction: "R"},
+		{OriginCode: "5143", DestinationCode: "1072", Direction: "R"},
+	}
+
+	assert.Equal(t, []string{"5565", "5598"}, exploreOrigins(flows, dst))
+}
+
+func Test_rankOrigins(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+		{TicketCode: "SDR", Description: "ANYTIME DAY R", TktType: "R"},
+	})
+
+	dst := map[string]string{"5143": models.NLCSourceStation, "1072": models.NLCSourceGroup}
+	names := map[string]string{"5598": "WOKING", "5565": "GUILDFORD"}
+
+	fares := []*models.FareDetailExtreme{
+		{OriginCode: "5598", DestinationCode: "5143", TicketCode: "7DS", AdultFare: 6000},
+		{OriginCode: "5598", DestinationCode: "1072", TicketCode: "7DS", AdultFare: 5500},
+		{OriginCode: "5598", DestinationCode: "5143", TicketCode: "SDR", AdultFare: 900},
+		{OriginCode: "5143", DestinationCode: "5565", TicketCode: "7DS", AdultFare: 7000},
+		{OriginCode: "9999", DestinationCode: "5143", TicketCode: "7DS", AdultFare: 20000},
+	}
+
+	tests := []struct {
+		name      string
+		maxAnnual float64
+		want      []string
+	}{
+		{"should rank every origin by annual price", 0, []string{"WOKING", "GUILDFORD", "9999"}},
+		{"should drop origins above the maximum annual", 3000, []string{"WOKING", "GUILDFORD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankOrigins(fares, dst, catalogue, names, tt.maxAnnual)
+
+			var origins []string
+			for _, r := range got {
+				origins = append(origins, r.OriginName)
+			}
+			assert.Equal(t, tt.want, origins)
+			assert.Equal(t, models.NLCSourceGroup, got[0].ViaDest)
+			assert.Equal(t, 2200.0, got[0].Annual)
+		})
+	}
+}
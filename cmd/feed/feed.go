@@ -0,0 +1,449 @@
+package feed
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UpdateMarker is the first character of every feed record and says how it should be applied
+type UpdateMarker string
+
+const (
+	// Refresh records make up a full refresh file and replace the whole table
+	Refresh UpdateMarker = "R"
+	// Insert records are new rows in a changes-only file
+	Insert UpdateMarker = "I"
+	// Amend records replace the non-key fields of an existing row
+	Amend UpdateMarker = "A"
+	// Delete records remove an existing row
+	Delete UpdateMarker = "D"
+)
+
+// feedDateLayout is the ddmmyyyy format used for every date in the feed
+const feedDateLayout = "02012006"
+
+// fileNamePattern matches files such as RJFAF123.FFL and captures the sequence and extension
+var fileNamePattern = regexp.MustCompile(`(?i)^RJFA[A-Z]?(\d{3})\.(FFL|LOC|NFO)$`)
+
+// Feed is a single fares feed drop, either a full refresh or a changes-only update
+type Feed struct {
+	Sequence  int
+	Full      bool
+	Flows     []*FlowRecord
+	Fares     []*FareRecord
+	Locations []*LocationRecord
+	Overrides []*FareOverrideRecord
+}
+
+// FlowRecord is an F record from the .FFL file
+type FlowRecord struct {
+	Marker          UpdateMarker
+	FlowID          string
+	OriginCode      string
+	DestinationCode string
+	RouteCode       string
+	StatusCode      string
+	UsageCode       string
+	Direction       string
+	EndDate         *time.Time
+	StartDate       *time.Time
+	TOC             string
+	CrossLondonInd  string
+	NsDiscInd       string
+	PublicationInd  string
+}
+
+// FareRecord is a T record from the .FFL file
+type FareRecord struct {
+	Marker          UpdateMarker
+	FlowID          string
+	TicketCode      string
+	Fare            uint
+	RestrictionCode string
+}
+
+// LocationRecord is an L record from the .LOC file
+type LocationRecord struct {
+	Marker        UpdateMarker
+	UIC           string
+	EndDate       *time.Time
+	StartDate     *time.Time
+	QuoteDate     *time.Time
+	AdminAreaCode string
+	NLC           string
+	Description   string
+	CRS           string
+	ResvCode      string
+	ERSCountry    string
+	ERSCode       string
+	FareGroup     string
+	County        string
+	PTECode       string
+	ZoneNo        string
+	ZoneInd       string
+	Region        string
+	Hierarchy     string
+	// LULZones flags which London Underground zones 1 to 6 the location is in
+	LULZones [6]string
+}
+
+// FareOverrideRecord is a record from the .NFO file
+type FareOverrideRecord struct {
+	Marker             UpdateMarker
+	OriginCode         string
+	DestinationCode    string
+	RouteCode          string
+	RailcardCode       string
+	TicketCode         string
+	NdRecordType       string
+	EndDate            *time.Time
+	StartDate          *time.Time
+	QuoteDate          *time.Time
+	SuppressMkr        string
+	AdultFare          uint
+	ChildFare          uint
+	RestrictionCode    string
+	CompositeIndicator string
+	CrossLondonInd     string
+	PsInd              string
+}
+
+// Load parses every recognised feed file in dir, which must all share the same sequence number
+func Load(dir string) (*Feed, error) {
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing feed directory %s", dir)
+	}
+	sort.Strings(entries)
+
+	f := &Feed{Sequence: -1}
+	found := false
+
+	for _, path := range entries {
+		match := fileNamePattern.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			continue
+		}
+
+		seq, _ := strconv.Atoi(match[1])
+		if f.Sequence >= 0 && f.Sequence != seq {
+			return nil, errors.Errorf("feed files have mixed sequence numbers %03d and %03d", f.Sequence, seq)
+		}
+		f.Sequence = seq
+
+		if err := parseFile(f, path, strings.ToUpper(match[2])); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", path)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, errors.Errorf("no FFL, LOC or NFO feed files found in %s", dir)
+	}
+
+	full, err := f.refresh()
+	if err != nil {
+		return nil, err
+	}
+	f.Full = full
+
+	return f, nil
+}
+
+func parseFile(f *Feed, path, ext string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Parse(f, file, ext)
+}
+
+// Parse reads records of the given file type (FFL, LOC or NFO) from r into f
+func Parse(f *Feed, r io.Reader, ext string) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024), 1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// Comment lines hold the file header
+		if line == "" || strings.HasPrefix(line, "/") {
+			continue
+		}
+
+		var err error
+		switch ext {
+		case "FFL":
+			err = f.parseFlowFileLine(line)
+		case "LOC":
+			err = f.parseLocationLine(line)
+		case "NFO":
+			err = f.parseFareOverrideLine(line)
+		default:
+			return errors.Errorf("unsupported feed file type %s", ext)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "line %d", lineNo)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (f *Feed) parseFlowFileLine(line string) error {
+
+	if len(line) < 2 {
+		return errors.Errorf("record too short")
+	}
+
+	marker, err := parseMarker(line)
+	if err != nil {
+		return err
+	}
+
+	switch line[1] {
+	case 'F':
+		if len(line) < 49 {
+			return errors.Errorf("flow record too short: %d characters", len(line))
+		}
+		endDate, err := parseDate(field(line, 20, 8))
+		if err != nil {
+			return err
+		}
+		startDate, err := parseDate(field(line, 28, 8))
+		if err != nil {
+			return err
+		}
+		f.Flows = append(f.Flows, &FlowRecord{
+			Marker:          marker,
+			OriginCode:      field(line, 2, 4),
+			DestinationCode: field(line, 6, 4),
+			RouteCode:       field(line, 10, 5),
+			StatusCode:      field(line, 15, 3),
+			UsageCode:       field(line, 18, 1),
+			Direction:       field(line, 19, 1),
+			EndDate:         endDate,
+			StartDate:       startDate,
+			TOC:             field(line, 36, 3),
+			CrossLondonInd:  field(line, 39, 1),
+			NsDiscInd:       field(line, 40, 1),
+			PublicationInd:  field(line, 41, 1),
+			FlowID:          field(line, 42, 7),
+		})
+	case 'T':
+		if len(line) < 22 {
+			return errors.Errorf("fare record too short: %d characters", len(line))
+		}
+		fare, err := parseAmount(field(line, 12, 8))
+		if err != nil {
+			return err
+		}
+		f.Fares = append(f.Fares, &FareRecord{
+			Marker:          marker,
+			FlowID:          field(line, 2, 7),
+			TicketCode:      field(line, 9, 3),
+			Fare:            fare,
+			RestrictionCode: field(line, 20, 2),
+		})
+	default:
+		return errors.Errorf("unknown FFL record type %q", line[1])
+	}
+
+	return nil
+}
+
+func (f *Feed) parseLocationLine(line string) error {
+
+	if len(line) < 2 {
+		return errors.Errorf("record too short")
+	}
+
+	// Only L records are loaded, the group and association records live in other tables
+	if line[1] != 'L' {
+		return nil
+	}
+
+	if len(line) < 87 {
+		return errors.Errorf("location record too short: %d characters", len(line))
+	}
+
+	marker, err := parseMarker(line)
+	if err != nil {
+		return err
+	}
+
+	dates := make([]*time.Time, 3)
+	for i, start := range []int{9, 17, 25} {
+		if dates[i], err = parseDate(field(line, start, 8)); err != nil {
+			return err
+		}
+	}
+
+	f.Locations = append(f.Locations, &LocationRecord{
+		Marker:        marker,
+		UIC:           field(line, 2, 7),
+		EndDate:       dates[0],
+		StartDate:     dates[1],
+		QuoteDate:     dates[2],
+		AdminAreaCode: field(line, 33, 3),
+		NLC:           field(line, 36, 4),
+		Description:   field(line, 40, 16),
+		CRS:           field(line, 56, 3),
+		ResvCode:      field(line, 59, 5),
+		ERSCountry:    field(line, 64, 2),
+		ERSCode:       field(line, 66, 3),
+		FareGroup:     field(line, 69, 6),
+		County:        field(line, 75, 2),
+		PTECode:       field(line, 77, 2),
+		ZoneNo:        field(line, 79, 4),
+		ZoneInd:       field(line, 83, 2),
+		Region:        field(line, 85, 1),
+		Hierarchy:     field(line, 86, 1),
+	})
+
+	// The London fields sit after the descriptions and are blank outside London
+	for i := range f.Locations[len(f.Locations)-1].LULZones {
+		f.Locations[len(f.Locations)-1].LULZones[i] = field(line, 262+i, 1)
+	}
+
+	return nil
+}
+
+func (f *Feed) parseFareOverrideLine(line string) error {
+
+	if len(line) < 67 {
+		return errors.Errorf("fare override record too short: %d characters", len(line))
+	}
+
+	marker, err := parseMarker(line)
+	if err != nil {
+		return err
+	}
+
+	dates := make([]*time.Time, 3)
+	for i, start := range []int{21, 29, 37} {
+		if dates[i], err = parseDate(field(line, start, 8)); err != nil {
+			return err
+		}
+	}
+
+	adult, err := parseAmount(field(line, 46, 8))
+	if err != nil {
+		return err
+	}
+	child, err := parseAmount(field(line, 54, 8))
+	if err != nil {
+		return err
+	}
+
+	f.Overrides = append(f.Overrides, &FareOverrideRecord{
+		Marker:             marker,
+		OriginCode:         field(line, 1, 4),
+		DestinationCode:    field(line, 5, 4),
+		RouteCode:          field(line, 9, 5),
+		RailcardCode:       field(line, 14, 3),
+		TicketCode:         field(line, 17, 3),
+		NdRecordType:       field(line, 20, 1),
+		EndDate:            dates[0],
+		StartDate:          dates[1],
+		QuoteDate:          dates[2],
+		SuppressMkr:        field(line, 45, 1),
+		AdultFare:          adult,
+		ChildFare:          child,
+		RestrictionCode:    field(line, 62, 2),
+		CompositeIndicator: field(line, 64, 1),
+		CrossLondonInd:     field(line, 65, 1),
+		PsInd:              field(line, 66, 1),
+	})
+
+	return nil
+}
+
+// refresh reports whether every record is a refresh record, rejecting feeds that mix the two
+func (f *Feed) refresh() (bool, error) {
+
+	var markers []UpdateMarker
+	for _, r := range f.Flows {
+		markers = append(markers, r.Marker)
+	}
+	for _, r := range f.Fares {
+		markers = append(markers, r.Marker)
+	}
+	for _, r := range f.Locations {
+		markers = append(markers, r.Marker)
+	}
+	for _, r := range f.Overrides {
+		markers = append(markers, r.Marker)
+	}
+
+	if len(markers) == 0 {
+		return false, errors.New("feed contains no records")
+	}
+
+	refreshes := 0
+	for _, m := range markers {
+		if m == Refresh {
+			refreshes++
+		}
+	}
+
+	if refreshes > 0 && refreshes != len(markers) {
+		return false, errors.New("feed mixes refresh and changes-only records")
+	}
+
+	return refreshes > 0, nil
+}
+
+func parseMarker(line string) (UpdateMarker, error) {
+	m := UpdateMarker(line[0:1])
+	switch m {
+	case Refresh, Insert, Amend, Delete:
+		return m, nil
+	}
+	return "", errors.Errorf("unknown update marker %q", line[0:1])
+}
+
+func parseDate(s string) (*time.Time, error) {
+	d, err := time.Parse(feedDateLayout, s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing date %q", s)
+	}
+	return &d, nil
+}
+
+func parseAmount(s string) (uint, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing amount %q", s)
+	}
+	return uint(v), nil
+}
+
+// field returns the trimmed fixed-width field starting at the zero-based start position
+func field(line string, start, length int) string {
+	if start >= len(line) {
+		return ""
+	}
+	end := start + length
+	if end > len(line) {
+		end = len(line)
+	}
+	return strings.TrimSpace(line[start:end])
+}
@@ -0,0 +1,186 @@
+package feed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDateField(year int, month time.Month, day int) *time.Time {
+	d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+var infiniteTime = newDateField(2999, 12, 31)
+
+const (
+	flowLine     = "RF5486543301000000AS3112299902012020SN 00Y0137711"
+	fareLine     = "RT01377117DS00005300  "
+	overrideLine = "I5486543301000   7DSN31122999020120200201202000000530000002650  000"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ext     string
+		input   string
+		want    *Feed
+		wantErr bool
+	}{
+		{
+			name:  "should parse flow and fare records skipping header comments",
+			ext:   "FFL",
+			input: "/!! Start of file\n" + flowLine + "\n" + fareLine + "\n",
+			want: &Feed{
+				Flows: []*FlowRecord{
+					{
+						Marker:          Refresh,
+						FlowID:          "0137711",
+						OriginCode:      "5486",
+						DestinationCode: "5433",
+						RouteCode:       "01000",
+						StatusCode:      "000",
+						UsageCode:       "A",
+						Direction:       "S",
+						EndDate:         infiniteTime,
+						StartDate:       newDateField(2020, 1, 2),
+						TOC:             "SN",
+						CrossLondonInd:  "0",
+						NsDiscInd:       "0",
+						PublicationInd:  "Y",
+					},
+				},
+				Fares: []*FareRecord{
+					{
+						Marker:     Refresh,
+						FlowID:     "0137711",
+						TicketCode: "7DS",
+						Fare:       5300,
+					},
+				},
+			},
+		},
+		{
+			name:  "should parse fare override records",
+			ext:   "NFO",
+			input: overrideLine,
+			want: &Feed{
+				Overrides: []*FareOverrideRecord{
+					{
+						Marker:             Insert,
+						OriginCode:         "5486",
+						DestinationCode:    "5433",
+						RouteCode:          "01000",
+						RailcardCode:       "",
+						TicketCode:         "7DS",
+						NdRecordType:       "N",
+						EndDate:            infiniteTime,
+						StartDate:          newDateField(2020, 1, 2),
+						QuoteDate:          newDateField(2020, 1, 2),
+						SuppressMkr:        "0",
+						AdultFare:          5300,
+						ChildFare:          2650,
+						CompositeIndicator: "0",
+						CrossLondonInd:     "0",
+						PsInd:              "0",
+					},
+				},
+			},
+		},
+		{
+			name:    "should error given an unknown update marker",
+			ext:     "FFL",
+			input:   "X" + flowLine[1:],
+			wantErr: true,
+		},
+		{
+			name:    "should error given a truncated flow record",
+			ext:     "FFL",
+			input:   flowLine[:30],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Feed{}
+			err := Parse(got, strings.NewReader(tt.input), tt.ext)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantSeq  int
+		wantFull bool
+		wantErr  bool
+	}{
+		{
+			name:     "should load a full refresh",
+			files:    map[string]string{"RJFAF123.FFL": flowLine + "\n" + fareLine},
+			wantSeq:  123,
+			wantFull: true,
+		},
+		{
+			name: "should load a changes-only feed",
+			files: map[string]string{
+				"RJFAC124.FFL": "A" + fareLine[1:],
+				"RJFAC124.NFO": overrideLine,
+			},
+			wantSeq:  124,
+			wantFull: false,
+		},
+		{
+			name: "should error given mixed sequence numbers",
+			files: map[string]string{
+				"RJFAC124.FFL": "A" + fareLine[1:],
+				"RJFAC125.NFO": overrideLine,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "should error given mixed refresh and changes records",
+			files:   map[string]string{"RJFAF123.FFL": flowLine + "\n" + "D" + fareLine[1:]},
+			wantErr: true,
+		},
+		{
+			name:    "should error given no feed files",
+			files:   map[string]string{"README": "nothing here"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "feed")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for name, content := range tt.files {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+			}
+
+			got, err := Load(dir)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSeq, got.Sequence)
+			assert.Equal(t, tt.wantFull, got.Full)
+		})
+	}
+}
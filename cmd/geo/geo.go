@@ -0,0 +1,162 @@
+// Package geo converts station coordinates and measures the distance between them
+package geo
+
+import "math"
+
+const (
+	earthRadiusKm = 6371.0088
+	kmPerMile     = 1.609344
+)
+
+// Point is a WGS84 latitude and longitude in degrees
+type Point struct {
+	Lat, Lon float64
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance is the great circle distance between two points in kilometres, using the haversine formula
+func Distance(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLon := radians(b.Lon - a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Miles converts kilometres to miles
+func Miles(km float64) float64 {
+	return km / kmPerMile
+}
+
+// BoundingBox returns the corners of a box that contains every point within km of p
+func BoundingBox(p Point, km float64) (min, max Point) {
+	dLat := degrees(km / earthRadiusKm)
+	dLon := degrees(km / (earthRadiusKm * math.Cos(radians(p.Lat))))
+	return Point{p.Lat - dLat, p.Lon - dLon}, Point{p.Lat + dLat, p.Lon + dLon}
+}
+
+// ellipsoid is the shape of the earth a set of coordinates is measured on
+type ellipsoid struct {
+	a, b float64
+}
+
+func (e ellipsoid) e2() float64 {
+	return 1 - (e.b*e.b)/(e.a*e.a)
+}
+
+var (
+	airy1830 = ellipsoid{a: 6377563.396, b: 6356256.909}
+	wgs84    = ellipsoid{a: 6378137.000, b: 6356752.3142}
+)
+
+// National Grid transverse mercator projection
+const (
+	gridF0   = 0.9996012717
+	gridLat0 = 49.0
+	gridLon0 = -2.0
+	gridN0   = -100000.0
+	gridE0   = 400000.0
+)
+
+// FromOSGB converts an Ordnance Survey National Grid easting and northing in metres to WGS84,
+// which is accurate to within a few metres across Great Britain
+func FromOSGB(easting, northing float64) Point {
+	lat, lon := gridToOSGB36(easting, northing)
+	x, y, z := toCartesian(airy1830, lat, lon)
+	x, y, z = osgb36ToWGS84(x, y, z)
+	lat, lon = fromCartesian(wgs84, x, y, z)
+	return Point{degrees(lat), degrees(lon)}
+}
+
+// gridToOSGB36 reverses the National Grid projection, returning OSGB36 latitude and longitude in radians
+func gridToOSGB36(easting, northing float64) (float64, float64) {
+
+	a, b := airy1830.a, airy1830.b
+	e2 := airy1830.e2()
+	n := (a - b) / (a + b)
+	n2, n3 := n*n, n*n*n
+	lat0, lon0 := radians(gridLat0), radians(gridLon0)
+
+	meridionalArc := func(lat float64) float64 {
+		return b * gridF0 * ((1+n+5.0/4*n2+5.0/4*n3)*(lat-lat0) -
+			(3*n+3*n2+21.0/8*n3)*math.Sin(lat-lat0)*math.Cos(lat+lat0) +
+			(15.0/8*n2+15.0/8*n3)*math.Sin(2*(lat-lat0))*math.Cos(2*(lat+lat0)) -
+			35.0/24*n3*math.Sin(3*(lat-lat0))*math.Cos(3*(lat+lat0)))
+	}
+
+	lat, m := lat0, 0.0
+	for {
+		lat = (northing-gridN0-m)/(a*gridF0) + lat
+		m = meridionalArc(lat)
+		if math.Abs(northing-gridN0-m) < 0.00001 {
+			break
+		}
+	}
+
+	sinLat := math.Sin(lat)
+	nu := a * gridF0 / math.Sqrt(1-e2*sinLat*sinLat)
+	rho := a * gridF0 * (1 - e2) / math.Pow(1-e2*sinLat*sinLat, 1.5)
+	eta2 := nu/rho - 1
+
+	tan := math.Tan(lat)
+	tan2, tan4, tan6 := tan*tan, math.Pow(tan, 4), math.Pow(tan, 6)
+	sec := 1 / math.Cos(lat)
+	nu3, nu5, nu7 := math.Pow(nu, 3), math.Pow(nu, 5), math.Pow(nu, 7)
+
+	vii := tan / (2 * rho * nu)
+	viii := tan / (24 * rho * nu3) * (5 + 3*tan2 + eta2 - 9*tan2*eta2)
+	ix := tan / (720 * rho * nu5) * (61 + 90*tan2 + 45*tan4)
+	x := sec / nu
+	xi := sec / (6 * nu3) * (nu/rho + 2*tan2)
+	xii := sec / (120 * nu5) * (5 + 28*tan2 + 24*tan4)
+	xiia := sec / (5040 * nu7) * (61 + 662*tan2 + 1320*tan4 + 720*tan6)
+
+	dE := easting - gridE0
+	lat = lat - vii*math.Pow(dE, 2) + viii*math.Pow(dE, 4) - ix*math.Pow(dE, 6)
+	lon := lon0 + x*dE - xi*math.Pow(dE, 3) + xii*math.Pow(dE, 5) - xiia*math.Pow(dE, 7)
+
+	return lat, lon
+}
+
+func toCartesian(e ellipsoid, lat, lon float64) (x, y, z float64) {
+	e2 := e.e2()
+	sinLat := math.Sin(lat)
+	nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+	return nu * math.Cos(lat) * math.Cos(lon), nu * math.Cos(lat) * math.Sin(lon), (1 - e2) * nu * sinLat
+}
+
+func fromCartesian(e ellipsoid, x, y, z float64) (lat, lon float64) {
+	e2 := e.e2()
+	p := math.Sqrt(x*x + y*y)
+	lat = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 10; i++ {
+		sinLat := math.Sin(lat)
+		nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+		lat = math.Atan2(z+e2*nu*sinLat, p)
+	}
+	return lat, math.Atan2(y, x)
+}
+
+// osgb36ToWGS84 applies the Helmert transformation from OSGB36 to WGS84
+func osgb36ToWGS84(x, y, z float64) (float64, float64, float64) {
+	const (
+		tx, ty, tz = 446.448, -125.157, 542.060
+		s          = -20.4894e-6
+	)
+	rx := radians(0.1502 / 3600)
+	ry := radians(0.2470 / 3600)
+	rz := radians(0.8421 / 3600)
+
+	return tx + (1+s)*x - rz*y + ry*z,
+		ty + rz*x + (1+s)*y - rx*z,
+		tz - ry*x + rx*y + (1+s)*z
+}
@@ -0,0 +1,52 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"should be zero for the same point", Point{51.5031, -0.1132}, Point{51.5031, -0.1132}, 0},
+		{"should measure London to Paris", Point{51.5074, -0.1278}, Point{48.8566, 2.3522}, 343.6},
+		{"should measure Waterloo to Woking", Point{51.5031, -0.1132}, Point{51.3185, -0.5570}, 36.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, Distance(tt.a, tt.b), 0.5)
+		})
+	}
+}
+
+func TestFromOSGB(t *testing.T) {
+	tests := []struct {
+		name              string
+		easting, northing float64
+		want              Point
+	}{
+		// Ordnance Survey worked example, OSGB36 52°39'27.2531"N 1°43'4.5177"E shifted to WGS84
+		{"should convert the OS worked example", 651409.903, 313177.270, Point{52.65798, 1.71605}},
+		{"should convert London Waterloo", 531120, 179840, Point{51.5031, -0.1132}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromOSGB(tt.easting, tt.northing)
+			assert.InDelta(t, tt.want.Lat, got.Lat, 0.001)
+			assert.InDelta(t, tt.want.Lon, got.Lon, 0.001)
+		})
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	p := Point{51.5031, -0.1132}
+	min, max := BoundingBox(p, 10)
+
+	for _, corner := range []Point{{min.Lat, p.Lon}, {max.Lat, p.Lon}, {p.Lat, min.Lon}, {p.Lat, max.Lon}} {
+		assert.InDelta(t, 10, Distance(p, corner), 0.01)
+	}
+}
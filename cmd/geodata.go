@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/geo"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var (
+	nearRadius float64
+	nearLimit  int
+)
+
+func init() {
+	dbCmd.AddCommand(dbImportGeoCmd)
+	stationsCmd.AddCommand(stationsNearCmd)
+	stationsCmd.AddCommand(stationsDistanceCmd)
+	stationsNearCmd.Flags().Float64VarP(&nearRadius, "radius", "r", 10, "Search radius in kilometres")
+	stationsNearCmd.Flags().IntVarP(&nearLimit, "limit", "n", 10, "Maximum number of stations to list")
+}
+
+var dbImportGeoCmd = &cobra.Command{
+	Use:   "import-geo <csv>",
+	Short: "Load station coordinates from a CSV",
+	Long: `Replaces the station_geo table with the coordinates in a CSV. The header row
+names the columns: crs along with either lat and lon in WGS84 degrees, or easting
+and northing on the Ordnance Survey National Grid in metres.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := importGeo(cmd.Context(), args[0]); err != nil {
+			logger.Error("error importing station coordinates", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var stationsNearCmd = &cobra.Command{
+	Use:   "near <lat> <lon>",
+	Short: "List the stations nearest to a point",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := stationsNear(args[0], args[1], nearRadius, nearLimit); err != nil {
+			logger.Error("error finding nearby stations", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var stationsDistanceCmd = &cobra.Command{
+	Use:   "distance <crs> <crs>",
+	Short: "Show the straight line distance between two stations",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := stationDistance(strings.ToUpper(args[0]), strings.ToUpper(args[1])); err != nil {
+			logger.Error("error measuring station distance", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// readStationGeo parses a CSV of station coordinates, converting grid references to WGS84
+func readStationGeo(r io.Reader) ([]*models.StationGeoData, error) {
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading station coordinates header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	column := func(names ...string) (int, bool) {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	crsCol, ok := column("crs")
+	if !ok {
+		return nil, errors.New("station coordinates need a crs column")
+	}
+
+	latCol, hasLat := column("lat", "latitude")
+	lonCol, hasLon := column("lon", "lng", "longitude")
+	eastCol, hasEast := column("easting")
+	northCol, hasNorth := column("northing")
+
+	grid := !(hasLat && hasLon)
+	if grid && !(hasEast && hasNorth) {
+		return nil, errors.New("station coordinates need lat and lon, or easting and northing columns")
+	}
+
+	var stations []*models.StationGeoData
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		crs := strings.ToUpper(strings.TrimSpace(record[crsCol]))
+		if crs == "" {
+			continue
+		}
+
+		first, second := latCol, lonCol
+		if grid {
+			first, second = eastCol, northCol
+		}
+
+		a, err := strconv.ParseFloat(strings.TrimSpace(record[first]), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d: invalid coordinate", line)
+		}
+		b, err := strconv.ParseFloat(strings.TrimSpace(record[second]), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d: invalid coordinate", line)
+		}
+
+		p := geo.Point{Lat: a, Lon: b}
+		if grid {
+			p = geo.FromOSGB(a, b)
+		}
+
+		stations = append(stations, &models.StationGeoData{CRS: crs, Latitude: p.Lat, Longitude: p.Lon})
+	}
+
+	return stations, nil
+}
+
+func importGeo(ctx context.Context, file string) error {
+
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stations, err := readStationGeo(in)
+	if err != nil {
+		return err
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	if err := repo.ImportStationGeo(ctx, stations); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported coordinates for %d stations\n", len(stations))
+
+	return nil
+}
+
+func stationsNear(lat, lon string, radius float64, limit int) error {
+
+	var p geo.Point
+	var err error
+	if p.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+		return errors.Wrap(err, "invalid latitude")
+	}
+	if p.Lon, err = strconv.ParseFloat(lon, 64); err != nil {
+		return errors.Wrap(err, "invalid longitude")
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	stations, err := repo.FindStationsNear(p, radius, limit)
+	if err != nil {
+		return err
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(stations)
+
+	return nil
+}
+
+// stationDistanceKm is the straight line distance between two stations with known coordinates
+func stationDistanceKm(repo repository.DtdRepository, from, to string) (float64, error) {
+
+	src, err := repo.FindStationGeo(from)
+	if err != nil {
+		return 0, errors.Wrapf(err, "finding coordinates for %s", from)
+	}
+
+	dst, err := repo.FindStationGeo(to)
+	if err != nil {
+		return 0, errors.Wrapf(err, "finding coordinates for %s", to)
+	}
+
+	return geo.Distance(src.Point(), dst.Point()), nil
+}
+
+func stationDistance(from, to string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	km, err := stationDistanceKm(repo, from, to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s to %s: %.1f km (%.1f miles)\n", from, to, km, geo.Miles(km))
+
+	return nil
+}
+
+// PricePerMile is what a fare costs for each mile travelled in a straight line
+type PricePerMile struct {
+	TicketCode string  `header:"ticket_code"`
+	TicketDesc string  `header:"tkt_desc"`
+	Price      float64 `header:"price"`
+	Journeys   float64 `header:"journeys"`
+	Miles      float64 `header:"miles"`
+	PerMile    float64 `header:"per_mile"`
+}
+
+// pricesPerMile prices the cheapest single, return and annual season per mile of each journey they cover
+func pricesPerMile(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue, miles float64) []*PricePerMile {
+
+	if miles <= 0 {
+		return nil
+	}
+
+	var cheapestSingle, cheapestReturn *models.FareDetailExtreme
+	for _, fare := range fares {
+		switch catalogue.ForFare(fare).TktType {
+		case models.TicketTypeSingle:
+			cheapestSingle = cheapest(cheapestSingle, fare)
+		case models.TicketTypeReturn:
+			cheapestReturn = cheapest(cheapestReturn, fare)
+		}
+	}
+
+	var rows []*PricePerMile
+	add := func(fare *models.FareDetailExtreme, desc string, price, journeys float64) {
+		rows = append(rows, &PricePerMile{
+			TicketCode: fare.TicketCode,
+			TicketDesc: desc,
+			Price:      price,
+			Journeys:   journeys,
+			Miles:      Round(miles, 0.1),
+			PerMile:    Round(price/journeys/miles, 0.01),
+		})
+	}
+
+	if cheapestSingle != nil {
+		add(cheapestSingle, cheapestSingle.TicketDesc, float64(cheapestSingle.AdultFare)/100, 1)
+	}
+	if cheapestReturn != nil {
+		add(cheapestReturn, cheapestReturn.TicketDesc, float64(cheapestReturn.AdultFare)/100, 2)
+	}
+	if weekly := pickCommuteFares(fares, catalogue).weekly; weekly != nil {
+		// Seasons are valued on the journeys Delay Repay deems them to cover
+		add(weekly, "ANNUAL SEASON", calculateFares(weekly.AdultFare).AnnualStd, seasonJourneys[PeriodAnnual])
+	}
+
+	return rows
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_readStationGeo(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    map[string][2]float64
+		wantErr bool
+	}{
+		{
+			name: "should read latitude and longitude",
+			csv:  "CRS,Latitude,Longitude\nwat,51.503106,-0.113184\nWOK, 51.318478, -0.557022\n",
+			want: map[string][2]float64{"WAT": {51.503106, -0.113184}, "WOK": {51.318478, -0.557022}},
+		},
+		{
+			name: "should convert eastings and northings",
+			csv:  "crs,easting,northing\nWAT,531120,179840\n",
+			want: map[string][2]float64{"WAT": {51.5031, -0.1132}},
+		},
+		{
+			name:    "should need coordinate columns",
+			csv:     "crs,x,y\nWAT,1,2\n",
+			wantErr: true,
+		},
+		{
+			name:    "should reject invalid coordinates",
+			csv:     "crs,lat,lon\nWAT,north,-0.1\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readStationGeo(strings.NewReader(tt.csv))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got, len(tt.want))
+			for _, s := range got {
+				assert.InDelta(t, tt.want[s.CRS][0], s.Latitude, 0.001, s.CRS)
+				assert.InDelta(t, tt.want[s.CRS][1], s.Longitude, 0.001, s.CRS)
+			}
+		})
+	}
+}
+
+func Test_pricesPerMile(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "SDS", Description: "ANYTIME DAY S", TktType: "S"},
+		{TicketCode: "SDR", Description: "ANYTIME DAY R", TktType: "R"},
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+	})
+
+	fares := []*models.FareDetailExtreme{
+		{TicketCode: "SDS", TicketDesc: "ANYTIME DAY S", AdultFare: 1000},
+		{TicketCode: "SDR", TicketDesc: "ANYTIME DAY R", AdultFare: 1600},
+		{TicketCode: "7DS", TicketDesc: "SEVEN DAY   STD", AdultFare: 5800},
+	}
+
+	got := pricesPerMile(fares, catalogue, 20)
+
+	assert.Len(t, got, 3)
+	assert.Equal(t, 0.5, got[0].PerMile)
+	assert.Equal(t, 0.4, got[1].PerMile)
+	assert.Equal(t, 2320.0, got[2].Price)
+	assert.Equal(t, 0.25, got[2].PerMile)
+
+	assert.Nil(t, pricesPerMile(fares, catalogue, 0))
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+func init() {
+	viper.SetDefault("goldcard.discount", 0.34)
+	// Empty means any TOC whose flows are flagged for Network discounts
+	viper.SetDefault("goldcard.tocs", []string{})
+}
+
+// goldCardFare applies the Gold Card discount to a fare in pence, rounding down to the nearest 5p
+// as railcard fares are
+func goldCardFare(pence uint, discount float64) uint {
+	discounted := math.Round(float64(pence) * (1 - discount))
+	return uint(math.Floor(discounted/5) * 5)
+}
+
+// applyGoldCard sets the Gold Card fare on every non-season fare
+func applyGoldCard(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue, discount float64) {
+	for _, fare := range fares {
+		if catalogue.ForFare(fare).IsSeason() {
+			continue
+		}
+		fare.GoldCardFare = goldCardFare(fare.AdultFare, discount)
+	}
+}
+
+// GoldCardEligibility says whether an annual season on a flow comes with a Gold Card
+type GoldCardEligibility struct {
+	Qualifies bool
+	Season    *models.FareDetailExtreme
+	Reason    string
+}
+
+// goldCardEligibility checks the cheapest season's flow is in the Network area and,
+// if any are configured, run by one of the Gold Card TOCs
+func goldCardEligibility(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue, tocs []string) *GoldCardEligibility {
+
+	season := pickCommuteFares(fares, catalogue).weekly
+	if season == nil {
+		return &GoldCardEligibility{Reason: "no season fares found"}
+	}
+
+	result := &GoldCardEligibility{Season: season}
+
+	if !season.InNetworkArea() {
+		result.Reason = fmt.Sprintf("flow %v is outside the Network discount area", season.FlowID)
+		return result
+	}
+
+	if len(tocs) > 0 {
+		found := false
+		for _, toc := range tocs {
+			if strings.EqualFold(toc, season.TOC) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Reason = fmt.Sprintf("%s is not a Gold Card TOC", season.TOC)
+			return result
+		}
+	}
+
+	result.Qualifies = true
+	result.Reason = fmt.Sprintf("annual seasons on %s flow %v include a Gold Card", season.TOC, season.FlowID)
+
+	return result
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_goldCardFare(t *testing.T) {
+	tests := []struct {
+		name     string
+		pence    uint
+		discount float64
+		want     uint
+	}{
+		{"should take a third off", 1500, 0.34, 990},
+		{"should round down to the nearest 5p", 1620, 0.34, 1065},
+		{"should leave fare untouched with no discount", 950, 0, 950},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, goldCardFare(tt.pence, tt.discount))
+		})
+	}
+}
+
+func Test_goldCardEligibility(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "SDR", Description: "ANYTIME DAY R", TktType: "R"},
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+	})
+
+	tests := []struct {
+		name          string
+		nsDiscInd     string
+		toc           string
+		tocs          []string
+		wantQualifies bool
+	}{
+		{"should qualify on a Network flow", "1", "SWT", nil, true},
+		{"should not qualify outside the Network area", "0", "SWT", nil, false},
+		{"should qualify when the TOC is listed", "2", "SWT", []string{"swt", "SEC"}, true},
+		{"should not qualify when the TOC is not listed", "2", "GWR", []string{"SWT", "SEC"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fares := []*models.FareDetailExtreme{
+				{TicketCode: "SDR", TicketType: "R", AdultFare: 1620},
+				{TicketCode: "7DS", TicketType: "N", AdultFare: 5300, TOC: tt.toc, NsDiscInd: tt.nsDiscInd},
+			}
+
+			got := goldCardEligibility(fares, catalogue, tt.tocs)
+			assert.Equal(t, tt.wantQualifies, got.Qualifies, got.Reason)
+
+			applyGoldCard(fares, catalogue, 0.34)
+			assert.Equal(t, uint(1065), fares[0].GoldCardFare)
+			assert.Equal(t, uint(0), fares[1].GoldCardFare)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+// FareGroup is a set of fares for the same journey, product and price that differ only in how they are issued
+type FareGroup struct {
+	OriginCode      string `header:"origin_code"`
+	OriginName      string `header:"origin_name"`
+	OriginVia       string `header:"origin_via"`
+	DestinationCode string `header:"destination_code"`
+	DestinationName string `header:"destination_name"`
+	DestinationVia  string `header:"destination_via"`
+	RouteDesc       string `header:"route_desc"`
+	TicketCodes     string `header:"ticket_codes"`
+	TicketDesc      string `header:"tkt_desc"`
+	TicketType      string `header:"tkt_type"`
+	Fulfilment      string `header:"fulfilment"`
+	SmartcardOnly   bool   `header:"smartcard_only"`
+	AdultFare       uint   `header:"adult_fare"`
+	GoldCardFare    uint   `header:"gold_card_fare"`
+	RestrictionDesc string `header:"restriction_desc"`
+	fares           []*models.FareDetailExtreme
+}
+
+type fareGroupKey struct {
+	origin, destination, route string
+	class                      uint
+	ticketType, validity       string
+	fulfilmentFamily           string
+	restriction                string
+	fare                       uint
+}
+
+// groupFares collapses equivalent products, such as SMART 7DS and paper 7DS at the same price,
+// into a single row listing every ticket code and fulfilment that can be bought
+func groupFares(fares []*models.FareDetailExtreme, catalogue models.TicketCatalogue) []*FareGroup {
+
+	groups := make(map[fareGroupKey]*FareGroup)
+	var order []fareGroupKey
+
+	for _, fare := range fares {
+		ticket := catalogue.Lookup(fare.TicketCode)
+
+		// Flexi seasons are a different product to a full season so never merge with one
+		family := "standard"
+		if ticket.Fulfilment() == models.FulfilmentFlexi {
+			family = string(models.FulfilmentFlexi)
+		}
+
+		key := fareGroupKey{
+			origin:           fare.OriginCode,
+			destination:      fare.DestinationCode,
+			route:            fare.RouteCode,
+			class:            fare.TicketClass,
+			ticketType:       fare.TicketType,
+			validity:         ticket.ValidityCode,
+			fulfilmentFamily: family,
+			restriction:      fare.RestrictionCode,
+			fare:             fare.AdultFare,
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			group = &FareGroup{
+				OriginCode:      fare.OriginCode,
+				OriginName:      fare.OriginName,
+				OriginVia:       fare.OriginVia,
+				DestinationCode: fare.DestinationCode,
+				DestinationName: fare.DestinationName,
+				DestinationVia:  fare.DestinationVia,
+				RouteDesc:       fare.RouteDesc,
+				TicketType:      fare.TicketType,
+				AdultFare:       fare.AdultFare,
+				GoldCardFare:    fare.GoldCardFare,
+				RestrictionDesc: fare.RestrictionDesc,
+			}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.fares = append(group.fares, fare)
+	}
+
+	result := make([]*FareGroup, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		group.summarise(catalogue)
+		result = append(result, group)
+	}
+
+	return result
+}
+
+func (g *FareGroup) summarise(catalogue models.TicketCatalogue) {
+
+	var codes []string
+	fulfilments := make(map[string]bool)
+	smartcardOnly := true
+
+	for _, fare := range g.fares {
+		ticket := catalogue.Lookup(fare.TicketCode)
+		codes = append(codes, fare.TicketCode)
+		fulfilments[string(ticket.Fulfilment())] = true
+		if !ticket.IsSmartcard() {
+			smartcardOnly = false
+			// Prefer the paper description as it is the one people recognise
+			g.TicketDesc = fare.TicketDesc
+		}
+	}
+
+	if g.TicketDesc == "" {
+		g.TicketDesc = g.fares[0].TicketDesc
+	}
+
+	var kinds []string
+	for kind := range fulfilments {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	sort.Strings(codes)
+
+	g.TicketCodes = strings.Join(codes, ", ")
+	g.Fulfilment = strings.Join(kinds, ", ")
+	g.SmartcardOnly = smartcardOnly
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_groupFares(t *testing.T) {
+
+	catalogue := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "0AQ", Description: "SMART 7DS", TktClass: 2, TktType: "N", ValidityCode: "S1"},
+		{TicketCode: "0AS", Description: "SMART PSS", TktClass: 2, TktType: "N", ValidityCode: "S1"},
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktClass: 2, TktType: "N", ValidityCode: "S1"},
+		{TicketCode: "0AF", Description: "SMART SDS", TktClass: 2, TktType: "S", ValidityCode: "DS"},
+		{TicketCode: "FSS", Description: "FLEXI SEASON", TktClass: 2, TktType: "N", ValidityCode: "S1"},
+	})
+
+	fare := func(code, desc, ticketType string, price uint) *models.FareDetailExtreme {
+		return &models.FareDetailExtreme{
+			OriginCode:      "5486",
+			DestinationCode: "5433",
+			RouteCode:       "01000",
+			TicketCode:      code,
+			TicketDesc:      desc,
+			TicketClass:     2,
+			TicketType:      ticketType,
+			AdultFare:       price,
+		}
+	}
+
+	fares := []*models.FareDetailExtreme{
+		fare("0AQ", "SMART 7DS", "N", 5300),
+		fare("0AS", "SMART PSS", "N", 5300),
+		fare("7DS", "SEVEN DAY   STD", "N", 5300),
+		fare("0AF", "SMART SDS", "S", 850),
+		fare("FSS", "FLEXI SEASON", "N", 5300),
+	}
+
+	got := groupFares(fares, catalogue)
+
+	assert.Len(t, got, 3)
+
+	assert.Equal(t, "0AQ, 0AS, 7DS", got[0].TicketCodes)
+	assert.Equal(t, "SEVEN DAY   STD", got[0].TicketDesc)
+	assert.Equal(t, "paper, smartcard", got[0].Fulfilment)
+	assert.False(t, got[0].SmartcardOnly)
+
+	assert.Equal(t, "0AF", got[1].TicketCodes)
+	assert.Equal(t, "smartcard", got[1].Fulfilment)
+	assert.True(t, got[1].SmartcardOnly)
+
+	assert.Equal(t, "FSS", got[2].TicketCodes)
+	assert.Equal(t, "flexi", got[2].Fulfilment)
+	assert.True(t, got[2].SmartcardOnly)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+var (
+	archiveRound       string
+	archiveEffective   string
+	historyTicketCodes []string
+	historySince       string
+	historyUntil       string
+)
+
+func init() {
+	dbCmd.AddCommand(dbArchiveCmd)
+	dbArchiveCmd.Flags().StringVar(&archiveRound, "round", "", "Name of the fares round, such as 2021-03")
+	dbArchiveCmd.Flags().StringVar(&archiveEffective, "effective", "", "Date the fares took effect (YYYY-MM-DD, default today)")
+
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code")
+	historyCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code")
+	historyCmd.Flags().StringSliceVar(&historyTicketCodes, "ticket-code", nil, "Ticket codes to show (default all)")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "Only show rounds effective on or after this date (YYYY-MM-DD)")
+	historyCmd.Flags().StringVar(&historyUntil, "until", "", "Only show rounds effective on or before this date (YYYY-MM-DD)")
+	historyCmd.MarkFlagRequired("from")
+	historyCmd.MarkFlagRequired("to")
+}
+
+var dbArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Archive the current fares so their history is kept after the next round",
+	Long: `Copies every fare and fare override valid on the effective date into the
+fare_history table, tagged with the round name. Archiving the same date again
+replaces it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := archiveFares(cmd.Context(), archiveRound, archiveEffective); err != nil {
+			logger.Error("error archiving fares", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show how fares between two stations have changed across archived rounds",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := fareHistory(strings.ToUpper(fromStation), strings.ToUpper(toStation), historyTicketCodes, historySince, historyUntil); err != nil {
+			logger.Error("error showing fare history", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// FarePoint is the cheapest fare for a ticket code in one archived round
+type FarePoint struct {
+	TicketCode    string  `header:"ticket_code"`
+	Round         string  `header:"round"`
+	EffectiveFrom string  `header:"effective_from"`
+	Fare          float64 `header:"fare"`
+	Change        string  `header:"change"`
+	YearOnYear    string  `header:"year_on_year"`
+	effective     time.Time
+}
+
+func percentChange(from, to float64) string {
+	if from == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", (to-from)/from*100)
+}
+
+// fareTimeline reduces archived fares to the cheapest per ticket code and round, with the change
+// on the previous round and on the latest round at least a year earlier
+func fareTimeline(history []*models.FareHistoryData) []*FarePoint {
+
+	type key struct {
+		code      string
+		effective time.Time
+	}
+
+	cheapestIn := map[key]*FarePoint{}
+	for _, h := range history {
+		k := key{h.TicketCode, h.EffectiveFrom}
+		fare := float64(h.Fare) / 100
+		if p, ok := cheapestIn[k]; !ok || fare < p.Fare {
+			cheapestIn[k] = &FarePoint{
+				TicketCode:    h.TicketCode,
+				Round:         h.Round,
+				EffectiveFrom: h.EffectiveFrom.Format(planDateLayout),
+				Fare:          fare,
+				effective:     h.EffectiveFrom,
+			}
+		}
+	}
+
+	points := make([]*FarePoint, 0, len(cheapestIn))
+	for _, p := range cheapestIn {
+		points = append(points, p)
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].TicketCode != points[j].TicketCode {
+			return points[i].TicketCode < points[j].TicketCode
+		}
+		return points[i].effective.Before(points[j].effective)
+	})
+
+	for i, p := range points {
+		if i == 0 || points[i-1].TicketCode != p.TicketCode {
+			continue
+		}
+		p.Change = percentChange(points[i-1].Fare, p.Fare)
+
+		yearAgo := p.effective.AddDate(-1, 0, 0)
+		for j := i - 1; j >= 0 && points[j].TicketCode == p.TicketCode; j-- {
+			if !points[j].effective.After(yearAgo) {
+				p.YearOnYear = percentChange(points[j].Fare, p.Fare)
+				break
+			}
+		}
+	}
+
+	return points
+}
+
+func archiveFares(ctx context.Context, round, effective string) error {
+
+	date := time.Now()
+	if effective != "" {
+		var err error
+		if date, err = time.Parse(planDateLayout, effective); err != nil {
+			return errors.Wrap(err, "invalid --effective")
+		}
+	}
+
+	if round == "" {
+		round = date.Format(planDateLayout)
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	archived, err := repo.ArchiveFares(ctx, round, date)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Archived %d fares as round %s effective %s\n", archived, round, date.Format(planDateLayout))
+
+	return nil
+}
+
+// parseOptionalDate parses a date flag, leaving it zero when it wasn't given
+func parseOptionalDate(s, flag string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.Parse(planDateLayout, s)
+	return d, errors.Wrapf(err, "invalid %s", flag)
+}
+
+func fareHistory(from, to string, ticketCodes []string, since, until string) error {
+
+	sinceDate, err := parseOptionalDate(since, "--since")
+	if err != nil {
+		return err
+	}
+
+	untilDate, err := parseOptionalDate(until, "--until")
+	if err != nil {
+		return err
+	}
+
+	if !sinceDate.IsZero() && !untilDate.IsZero() && untilDate.Before(sinceDate) {
+		return errors.New("--until must not be before --since")
+	}
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	srcNlcs, err := repo.FindNLCsRelatedToCrs(from)
+	if err != nil {
+		return errors.Wrapf(err, "finding NLCs related to source CRS")
+	}
+
+	dstNlcs, err := repo.FindNLCsRelatedToCrs(to)
+	if err != nil {
+		return errors.Wrapf(err, "finding NLCs related to destination CRS")
+	}
+
+	for i, code := range ticketCodes {
+		ticketCodes[i] = strings.ToUpper(code)
+	}
+
+	history, err := repo.FindFareHistory(models.NLCCodes(srcNlcs), models.NLCCodes(dstNlcs), ticketCodes, sinceDate, untilDate)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		return errors.Errorf("no archived fares found between %s and %s", from, to)
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(fareTimeline(history))
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fareTimeline(t *testing.T) {
+
+	date := func(s string) time.Time {
+		d, _ := time.Parse(planDateLayout, s)
+		return d
+	}
+
+	history := []*models.FareHistoryData{
+		{Round: "2019", EffectiveFrom: date("2019-01-02"), TicketCode: "7DS", Fare: 5000},
+		{Round: "2019", EffectiveFrom: date("2019-01-02"), TicketCode: "7DS", Fare: 5200},
+		{Round: "2020", EffectiveFrom: date("2020-01-02"), TicketCode: "7DS", Fare: 5150},
+		{Round: "2020-06", EffectiveFrom: date("2020-06-01"), TicketCode: "7DS", Fare: 5150},
+		{Round: "2021", EffectiveFrom: date("2021-03-01"), TicketCode: "7DS", Fare: 5200},
+		{Round: "2020", EffectiveFrom: date("2020-01-02"), TicketCode: "SDR", Fare: 1600},
+	}
+
+	got := fareTimeline(history)
+
+	assert.Len(t, got, 5)
+
+	assert.Equal(t, "2019", got[0].Round)
+	assert.Equal(t, 50.0, got[0].Fare)
+	assert.Equal(t, "", got[0].Change)
+	assert.Equal(t, "", got[0].YearOnYear)
+
+	assert.Equal(t, "+3.0%", got[1].Change)
+	assert.Equal(t, "+3.0%", got[1].YearOnYear)
+
+	assert.Equal(t, "+0.0%", got[2].Change)
+	assert.Equal(t, "+3.0%", got[2].YearOnYear)
+
+	// A year before March 2021 is the January 2020 round, not June
+	assert.Equal(t, "+1.0%", got[3].Change)
+	assert.Equal(t, "+1.0%", got[3].YearOnYear)
+
+	assert.Equal(t, "SDR", got[4].TicketCode)
+	assert.Equal(t, "", got[4].Change)
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var (
+	loanPrice  float64
+	loanPeriod string
+	loanStart  string
+	loanMonths int
+	loanFormat string
+	loanOutput string
+	loanClass  string
+)
+
+func init() {
+	rootCmd.AddCommand(loanCmd)
+	loanCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code, to price the season")
+	loanCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code, to price the season")
+	loanCmd.Flags().StringVarP(&loanClass, "class", "c", "2", "Class of the season when priced from stations")
+	loanCmd.Flags().Float64Var(&loanPrice, "price", 0, "Price of the season in pounds, instead of --from and --to")
+	loanCmd.Flags().StringVar(&loanPeriod, "period", PeriodAnnual, "Season period: weekly, monthly, 3-monthly, 6-monthly, annual or a number of days")
+	loanCmd.Flags().StringVar(&loanStart, "start", "", "Season start and first deduction date (YYYY-MM-DD)")
+	loanCmd.Flags().IntVarP(&loanMonths, "months", "m", 10, "Number of monthly deductions")
+	loanCmd.Flags().StringVar(&loanFormat, "format", "table", "Output format: table, csv or html")
+	loanCmd.Flags().StringVarP(&loanOutput, "output", "o", "", "File to write the schedule to (default stdout)")
+	loanCmd.MarkFlagRequired("start")
+}
+
+var loanCmd = &cobra.Command{
+	Use:   "loan",
+	Short: "Produce a season ticket loan repayment schedule",
+	Long: `Builds a schedule of monthly payroll deductions for an interest-free season
+ticket loan, showing after each deduction what is still owed, the refund the
+season would get if surrendered that day, and the balance either way.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loan(cmd.Context()); err != nil {
+			logger.Error("error running loan", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// LoanInstalment is a single payroll deduction
+type LoanInstalment struct {
+	Number        int     `header:"no"`
+	Date          string  `header:"date"`
+	Deduction     float64 `header:"deduction"`
+	Repaid        float64 `header:"repaid"`
+	Outstanding   float64 `header:"outstanding"`
+	RefundIfEnded float64 `header:"refund_if_ended"`
+	OwedIfEnded   float64 `header:"owed_if_ended"`
+}
+
+// LoanSchedule is the full repayment plan for a season ticket loan
+type LoanSchedule struct {
+	Price       float64
+	Period      string
+	Start       string
+	End         string
+	Instalments []*LoanInstalment
+}
+
+// seasonsFromPrice works back from a season price to the weekly fare it was derived from
+func seasonsFromPrice(price float64, period string) (*Fares, error) {
+
+	factors := map[string]float64{
+		PeriodWeekly:      1,
+		PeriodMonthly:     3.84,
+		PeriodThreeMonths: 3.84 * 3,
+		PeriodSixMonths:   3.84 * 6,
+		PeriodAnnual:      40,
+	}
+
+	p, err := parseSeasonPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	if factor, ok := factors[p.name]; ok {
+		return calculateFares(uint(math.Round(price / factor * 100))), nil
+	}
+
+	// Custom periods are pro rata on the annual season, unless that comes to less than
+	// a monthly season in which case the price paid was the monthly season
+	seasons := calculateFares(uint(math.Round(price * 365 / float64(p.days) / factors[PeriodAnnual] * 100)))
+	if seasons.MonthlyStd > price {
+		seasons = calculateFares(uint(math.Round(price / factors[PeriodMonthly] * 100)))
+	}
+	return seasons, nil
+}
+
+// loanSchedule splits the price into monthly deductions in whole pence, with any remainder
+// taken in the first deduction
+func loanSchedule(seasons *Fares, price float64, period string, start time.Time, months int) (*LoanSchedule, error) {
+
+	if months < 1 {
+		return nil, errors.Errorf("months must be at least 1, got %d", months)
+	}
+
+	end, err := seasonEnd(start, period)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPence := int64(math.Round(price * 100))
+	deduction := totalPence / int64(months)
+	remainder := totalPence - deduction*int64(months)
+
+	schedule := &LoanSchedule{
+		Price:  price,
+		Period: period,
+		Start:  start.Format(planDateLayout),
+		End:    end.Format(planDateLayout),
+	}
+
+	var repaid int64
+	for i := 0; i < months; i++ {
+		amount := deduction
+		if i == 0 {
+			amount += remainder
+		}
+		repaid += amount
+
+		date := start.AddDate(0, i, 0)
+		outstanding := float64(totalPence-repaid) / 100
+
+		refund := calculateRefund(seasons, price, start, end, date, defaultRefundRules).Amount
+
+		schedule.Instalments = append(schedule.Instalments, &LoanInstalment{
+			Number:        i + 1,
+			Date:          date.Format(planDateLayout),
+			Deduction:     float64(amount) / 100,
+			Repaid:        float64(repaid) / 100,
+			Outstanding:   outstanding,
+			RefundIfEnded: refund,
+			OwedIfEnded:   Round(outstanding-refund, 0.01),
+		})
+	}
+
+	return schedule, nil
+}
+
+var loanHTML = template.Must(template.New("loan").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Season ticket loan</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 4px 8px; text-align: right; }
+</style>
+</head>
+<body>
+<h1>Season ticket loan</h1>
+<p>{{.Period}} season costing &pound;{{printf "%.2f" .Price}}, valid {{.Start}} to {{.End}}</p>
+<table>
+<tr><th>No</th><th>Date</th><th>Deduction</th><th>Repaid</th><th>Outstanding</th><th>Refund if ended</th><th>Owed if ended</th></tr>
+{{range .Instalments}}<tr><td>{{.Number}}</td><td>{{.Date}}</td><td>{{printf "%.2f" .Deduction}}</td><td>{{printf "%.2f" .Repaid}}</td><td>{{printf "%.2f" .Outstanding}}</td><td>{{printf "%.2f" .RefundIfEnded}}</td><td>{{printf "%.2f" .OwedIfEnded}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var loanHeader = []string{"no", "date", "deduction", "repaid", "outstanding", "refund_if_ended", "owed_if_ended"}
+
+func writeLoanCSV(w io.Writer, schedule *LoanSchedule) error {
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(loanHeader); err != nil {
+		return err
+	}
+
+	money := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	for _, i := range schedule.Instalments {
+		err := writer.Write([]string{
+			strconv.Itoa(i.Number), i.Date, money(i.Deduction), money(i.Repaid),
+			money(i.Outstanding), money(i.RefundIfEnded), money(i.OwedIfEnded),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// cheapestSeasonFare looks up the cheapest weekly season fare between two stations
+func cheapestSeasonFare(ctx context.Context, repo repository.DtdRepository, catalogue models.TicketCatalogue, from, to, class string) (*models.FareDetailExtreme, error) {
+
+	fares, err := GetFaresContext(ctx, &GetFaresConfig{
+		Repo:        repo,
+		FromStation: from,
+		ToStation:   to,
+		Season:      true,
+		Class:       class,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	weekly := pickCommuteFares(fares, catalogue).weekly
+	if weekly == nil {
+		return nil, errors.Errorf("no season fares found between %s and %s", from, to)
+	}
+
+	return weekly, nil
+}
+
+// priceSeason looks up the cheapest season between two stations and prices it for a period
+func priceSeason(ctx context.Context, from, to, class, period string) (*Fares, float64, error) {
+
+	repo, err := newRepositoryContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "finding ticket types")
+	}
+
+	weekly, err := cheapestSeasonFare(ctx, repo, catalogue, from, to, class)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seasons := calculateFares(weekly.AdultFare)
+	price, err := seasonPrice(seasons, period)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return seasons, price, nil
+}
+
+func loan(ctx context.Context) error {
+
+	start, err := time.Parse(planDateLayout, loanStart)
+	if err != nil {
+		return errors.Wrap(err, "invalid --start")
+	}
+
+	var seasons *Fares
+	price := loanPrice
+
+	switch {
+	case fromStation != "" && toStation != "":
+		seasons, price, err = priceSeason(ctx, strings.ToUpper(fromStation), strings.ToUpper(toStation), loanClass, loanPeriod)
+	case loanPrice > 0:
+		seasons, err = seasonsFromPrice(loanPrice, loanPeriod)
+	default:
+		err = errors.New("either --price or both --from and --to are required")
+	}
+	if err != nil {
+		return err
+	}
+
+	schedule, err := loanSchedule(seasons, price, loanPeriod, start, loanMonths)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if loanOutput != "" {
+		if out, err = os.Create(loanOutput); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	switch loanFormat {
+	case "table":
+		fmt.Fprintf(out, "%s season costing £%.2f, valid %s to %s\n", schedule.Period, schedule.Price, schedule.Start, schedule.End)
+		printer := tableprinter.New(out)
+		printer.Print(schedule.Instalments)
+	case "csv":
+		err = writeLoanCSV(out, schedule)
+	case "html":
+		err = loanHTML.Execute(out, schedule)
+	default:
+		err = errors.Errorf("unknown output format %q", loanFormat)
+	}
+
+	return err
+}
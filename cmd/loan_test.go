@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_loanSchedule(t *testing.T) {
+
+	seasons := calculateFares(5300)
+
+	got, err := loanSchedule(seasons, 2120.03, PeriodAnnual, mustDate("2027-01-04"), 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2028-01-03", got.End)
+	assert.Len(t, got.Instalments, 10)
+
+	first := got.Instalments[0]
+	assert.Equal(t, "2027-01-04", first.Date)
+	assert.Equal(t, 212.03, first.Deduction)
+
+	second := got.Instalments[1]
+	assert.Equal(t, "2027-02-04", second.Date)
+	assert.Equal(t, 212.0, second.Deduction)
+	assert.Equal(t, 1696.0, second.Outstanding)
+	assert.Equal(t, 1906.53, second.RefundIfEnded)
+	assert.Equal(t, -210.53, second.OwedIfEnded)
+
+	last := got.Instalments[9]
+	assert.Equal(t, 2120.03, last.Repaid)
+	assert.Equal(t, 0.0, last.Outstanding)
+}
+
+func Test_seasonsFromPrice(t *testing.T) {
+
+	got, err := seasonsFromPrice(2120, PeriodAnnual)
+	assert.NoError(t, err)
+	assert.Equal(t, 53.0, got.WeeklyStd)
+
+	got, err = seasonsFromPrice(2120, "year")
+	assert.NoError(t, err)
+	assert.Equal(t, 53.0, got.WeeklyStd)
+
+	got, err = seasonsFromPrice(2000, "200")
+	assert.NoError(t, err)
+	assert.Equal(t, 91.25, got.WeeklyStd)
+	assert.InDelta(t, 2000, customPeriodPrice(got, 200), 0.1)
+
+	// Short enough to have been charged as a monthly season
+	got, err = seasonsFromPrice(100, "32")
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, got.MonthlyStd)
+
+	_, err = seasonsFromPrice(1000, "fortnightly")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// logger is replaced once the config has been read, until then it logs at info to the console
+var logger, _ = newLogger("info", LogFormatConsole)
+
+func init() {
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", LogFormatConsole)
+	viper.SetDefault("log.slow_query", 200*time.Millisecond)
+
+	rootCmd.PersistentFlags().String("log-level", "info", "Minimum level to log: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", LogFormatConsole, "Log as console or json")
+	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("log.format", rootCmd.PersistentFlags().Lookup("log-format"))
+}
+
+// newLogger builds a logger writing to stderr, so logs never mix with the tables and files
+// commands write to stdout
+func newLogger(level, format string) (*zap.Logger, error) {
+
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, errors.Errorf("unknown log level %q", level)
+	}
+
+	var config zap.Config
+	switch format {
+	case LogFormatConsole:
+		config = zap.NewDevelopmentConfig()
+		config.Development = false
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	case LogFormatJSON:
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return nil, errors.Errorf("unknown log format %q", format)
+	}
+
+	config.Level = zap.NewAtomicLevelAt(lvl)
+	config.OutputPaths = []string{"stderr"}
+	config.ErrorOutputPaths = []string{"stderr"}
+
+	return config.Build()
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_newLogger(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantDebug bool
+		wantErr   string
+	}{
+		{"should log info to the console", "info", LogFormatConsole, false, ""},
+		{"should log debug as json", "debug", LogFormatJSON, true, ""},
+		{"should accept upper case levels", "WARN", LogFormatJSON, false, ""},
+		{"should reject unknown levels", "loud", LogFormatJSON, false, `unknown log level "loud"`},
+		{"should reject unknown formats", "info", "logfmt", false, `unknown log format "logfmt"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLogger(tt.level, tt.format)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDebug, got.Core().Enabled(zapcore.DebugLevel))
+		})
+	}
+}
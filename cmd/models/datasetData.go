@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DatasetStaged has been loaded but never served queries
+	DatasetStaged = "staged"
+	// DatasetActive is the dataset currently in the live tables
+	DatasetActive = "active"
+	// DatasetInactive has been active before and can be rolled back to
+	DatasetInactive = "inactive"
+	// DatasetActivating is having its tables swapped in for the dataset it replaces
+	DatasetActivating = "activating"
+)
+
+// DatasetData tracks a complete fares round loaded into its own set of tables
+type DatasetData struct {
+	gorm.Model
+	Name        string     `header:"name"`
+	Sequence    int        `header:"sequence"`
+	Status      string     `header:"status"`
+	ActivatedAt *time.Time `header:"activated_at"`
+	// ReplacesID is the dataset being swapped out while this one is activating
+	ReplacesID *uint `header:"-"`
+}
+
+func (DatasetData) TableName() string {
+	return "dataset"
+}
@@ -40,14 +40,17 @@ type FareDetailExtreme struct {
 	FlowID          uint   `header:"flow_id"`
 	OriginCode      string `header:"origin_code"`
 	OriginName      string `header:"origin_name"`
+	OriginVia       string `header:"origin_via" gorm:"-"`
 	DestinationCode string `header:"destination_code"`
 	DestinationName string `header:"destination_name"`
+	DestinationVia  string `header:"destination_via" gorm:"-"`
 	RouteCode       string `header:"route_code"`
 	RouteDesc       string `header:"route_desc"`
 	RouteAaaDesc    string `header:"route_aaa_desc"`
 	StatusCode      string `header:"status_code"`
 	UsageCode       string `header:"usage_code"`
 	TOC             string `header:"toc"`
+	NsDiscInd       string `header:"ns_disc_ind"`
 	FareID          string `header:"fare_id"`
 	TicketCode      string `header:"ticket_code"`
 	TicketDesc      string `header:"tkt_desc"`
@@ -57,4 +60,20 @@ type FareDetailExtreme struct {
 	ChildFare       uint  `header:"child_fare"`
 	RestrictionCode string `header:"restriction_code"`
 	RestrictionDesc string `header:"restriction_desc"`
+	GoldCardFare    uint   `header:"gold_card_fare" gorm:"-"`
+}
+
+// InNetworkArea reports whether the flow is flagged for Network South East discounts such as the Gold Card
+func (f FareDetailExtreme) InNetworkArea() bool {
+	return f.NsDiscInd != "" && f.NsDiscInd != "0"
+}
+
+// Ticket returns the ticket type details that were joined onto the fare
+func (f FareDetailExtreme) Ticket() TicketTypeData {
+	return TicketTypeData{
+		TicketCode:  f.TicketCode,
+		Description: f.TicketDesc,
+		TktClass:    f.TicketClass,
+		TktType:     f.TicketType,
+	}
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// FareHistoryData is a fare as it was in an archived fares round
+type FareHistoryData struct {
+	ID              uint      `gorm:"primaryKey"`
+	Round           string    `gorm:"size:64"`
+	EffectiveFrom   time.Time `gorm:"type:date;index"`
+	FlowID          string    `gorm:"size:7"`
+	OriginCode      string    `gorm:"size:4;index:idx_fare_history_od"`
+	DestinationCode string    `gorm:"size:4;index:idx_fare_history_od"`
+	Direction       string    `gorm:"size:1"`
+	RouteCode       string    `gorm:"size:5"`
+	TOC             string    `gorm:"size:3"`
+	TicketCode      string    `gorm:"size:3"`
+	RestrictionCode string    `gorm:"size:2"`
+	Fare            uint
+	// Override is set for fares archived from non_derivable_fare_override rather than derived from flows
+	Override  bool
+	CreatedAt time.Time
+}
+
+func (FareHistoryData) TableName() string {
+	return "fare_history"
+}
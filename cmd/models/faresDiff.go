@@ -0,0 +1,35 @@
+package models
+
+// How a row differs between two fares rounds
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// FaresDiffRow is a single flow, fare, ticket type, route or override that differs between two rounds.
+// Fares are zero on the side of the diff the row is missing from.
+type FaresDiffRow struct {
+	ChangeType      string `header:"change"`
+	OriginCode      string `header:"origin_code"`
+	DestinationCode string `header:"destination_code"`
+	RouteCode       string `header:"route_code"`
+	TOC             string `header:"toc"`
+	Direction       string `header:"direction"`
+	TicketCode      string `header:"ticket_code"`
+	RestrictionCode string `header:"restriction_code"`
+	Description     string `header:"description"`
+	OldFare         uint   `header:"old_fare"`
+	NewFare         uint   `header:"new_fare"`
+}
+
+// FaresDiff is everything that differs between two fares rounds
+type FaresDiff struct {
+	Flows       []*FaresDiffRow
+	Fares       []*FaresDiffRow
+	TicketTypes []*FaresDiffRow
+	Routes      []*FaresDiffRow
+	Overrides   []*FaresDiffRow
+	// Unversioned names the kinds of row that weren't compared because datasets share their tables
+	Unversioned []string
+}
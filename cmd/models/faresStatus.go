@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// FaresStatus describes whether the fares tables are loaded and how recently they were updated
+type FaresStatus struct {
+	CurrentFlows int64
+	LastFeed     *FeedSequenceData
+}
+
+// Loaded reports whether there are flows valid today
+func (s FaresStatus) Loaded() bool {
+	return s.CurrentFlows > 0
+}
+
+// Current reports whether a feed was applied within maxAge of now. Tables loaded before feeds
+// were tracked have no feed recorded and are assumed to be current.
+func (s FaresStatus) Current(now time.Time, maxAge time.Duration) bool {
+	if s.LastFeed == nil {
+		return true
+	}
+	return now.Sub(s.LastFeed.CreatedAt) <= maxAge
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// FeedSequenceData records each fares feed that has been applied to the database
+type FeedSequenceData struct {
+	gorm.Model
+	Sequence int
+	Full     bool
+}
+
+func (FeedSequenceData) TableName() string {
+	return "feed_sequence"
+}
@@ -0,0 +1,14 @@
+package models
+
+// IntegrityCheckResult is the outcome of a single data integrity check
+type IntegrityCheckResult struct {
+	Name        string   `header:"check"`
+	Description string   `header:"description"`
+	Violations  int64    `header:"violations"`
+	Samples     []string `header:"-"`
+}
+
+// Passed reports whether the check found no violations
+func (r IntegrityCheckResult) Passed() bool {
+	return r.Violations == 0
+}
@@ -38,8 +38,8 @@ type LocationWithGroupData struct {
 
 // LocationGroup contains fields pulled from the subquery method
 type LocationGroup struct {
-	UIC         string
-	Description string
+	UIC         string `header:"group_uic"`
+	Description string `header:"group_description"`
 }
 
 // LocationWithGroups is a flattened struct from LocationWithGroupData
@@ -0,0 +1,36 @@
+package models
+
+// NLC sources describe which rule linked an NLC to a station, most specific first
+const (
+	NLCSourceStation          = "station"
+	NLCSourceCluster          = "cluster"
+	NLCSourceGroup            = "group"
+	NLCSourceGroupCluster     = "group cluster"
+	NLCSourceFareGroup        = "fare group"
+	NLCSourceFareGroupCluster = "fare group cluster"
+	NLCSourceZone             = "zone"
+)
+
+// RelatedNLC is an NLC that fares can be priced from for a station, along with why
+type RelatedNLC struct {
+	NLC    string `header:"nlc"`
+	Source string `header:"source"`
+}
+
+// NLCCodes returns just the codes from related NLCs
+func NLCCodes(related []*RelatedNLC) []string {
+	codes := make([]string, 0, len(related))
+	for _, r := range related {
+		codes = append(codes, r.NLC)
+	}
+	return codes
+}
+
+// NLCSources maps each related NLC code to the rule that found it
+func NLCSources(related []*RelatedNLC) map[string]string {
+	sources := make(map[string]string, len(related))
+	for _, r := range related {
+		sources[r.NLC] = r.Source
+	}
+	return sources
+}
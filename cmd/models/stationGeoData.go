@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/jdheyburn/stc/cmd/geo"
+)
+
+// StationGeoData is where a station is, keyed on CRS as the fares feed carries no coordinates
+type StationGeoData struct {
+	CRS       string  `gorm:"primaryKey;size:3"`
+	Latitude  float64 `gorm:"type:decimal(9,6)"`
+	Longitude float64 `gorm:"type:decimal(9,6)"`
+}
+
+func (StationGeoData) TableName() string {
+	return "station_geo"
+}
+
+// Point returns the station's coordinates
+func (s StationGeoData) Point() geo.Point {
+	return geo.Point{Lat: s.Latitude, Lon: s.Longitude}
+}
+
+// StationGeoDetail is a station's coordinates along with its name and distance from a search point
+type StationGeoDetail struct {
+	CRS         string  `header:"crs"`
+	NLC         string  `header:"nlc"`
+	Description string  `header:"description"`
+	Latitude    float64 `header:"latitude"`
+	Longitude   float64 `header:"longitude"`
+	DistanceKm  float64 `header:"distance_km" gorm:"-"`
+	Miles       float64 `header:"miles" gorm:"-"`
+}
+
+// Point returns the station's coordinates
+func (s StationGeoDetail) Point() geo.Point {
+	return geo.Point{Lat: s.Latitude, Lon: s.Longitude}
+}
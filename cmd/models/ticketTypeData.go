@@ -1,18 +1,173 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
+// Ticket types as held in ticket_type.tkt_type
+const (
+	TicketTypeSingle = "S"
+	TicketTypeReturn = "R"
+	TicketTypeSeason = "N"
+)
+
+// Fulfilment is how a ticket is issued to the passenger
+type Fulfilment string
+
 const (
-	Unknown TicketType = iota
-	WeeklyStd
-	WeeklyZ16TCStd
+	FulfilmentPaper     Fulfilment = "paper"
+	FulfilmentSmartcard Fulfilment = "smartcard"
+	FulfilmentETicket   Fulfilment = "e-ticket"
+	FulfilmentFlexi     Fulfilment = "flexi"
 )
 
-type TicketType int
+// TicketTypeData maps to rows in the ticket_type table, with validity LEFT JOINed from ticket_validity
+type TicketTypeData struct {
+	TicketCode       string     `header:"ticket_code"`
+	Description      string     `header:"description"`
+	TktClass         uint       `header:"class"`
+	TktType          string     `header:"type"`
+	TktGroup         string     `header:"group"`
+	MaxPassengers    uint       `header:"max_passengers"`
+	MinPassengers    uint       `header:"min_passengers"`
+	MaxAdults        uint       `header:"max_adults"`
+	MaxChildren      uint       `header:"max_children"`
+	ValidityCode     string     `header:"validity_code"`
+	DiscountCategory string     `header:"discount_category"`
+	StartDate        *time.Time `header:"-"`
+	EndDate          *time.Time `header:"-"`
+	// LEFT JOINed from ticket_validity
+	ValidityDesc string `header:"validity"`
+	OutDays      uint   `header:"out_days"`
+	OutMonths    uint   `header:"out_months"`
+	RetDays      uint   `header:"return_days"`
+	RetMonths    uint   `header:"return_months"`
+	// Set from TicketOverrides, taking precedence over the description
+	fulfilment Fulfilment
+	travelcard *bool
+}
+
+func (TicketTypeData) TableName() string {
+	return "ticket_type"
+}
+
+// IsSeason reports whether the ticket is a season ticket, including flexi seasons
+func (t TicketTypeData) IsSeason() bool {
+	return t.TktType == TicketTypeSeason || t.IsFlexiSeason()
+}
+
+// IsFlexiSeason reports whether the ticket is a carnet of travel days rather than a full season
+func (t TicketTypeData) IsFlexiSeason() bool {
+	return t.Fulfilment() == FulfilmentFlexi
+}
+
+// IsSmartcard reports whether the ticket is only issued on a smartcard
+func (t TicketTypeData) IsSmartcard() bool {
+	return t.Fulfilment() == FulfilmentSmartcard || t.Fulfilment() == FulfilmentFlexi
+}
 
-type TicketCode string
+// IsOffPeak reports whether the ticket can only be used outside the peak, from its description
+func (t TicketTypeData) IsOffPeak() bool {
+	desc := strings.ToUpper(t.Description)
+	for _, s := range []string{"OFF-PEAK", "OFF PEAK", "OFFPEAK", "SAVER", "CHEAP DAY"} {
+		if strings.Contains(desc, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fulfilment classifies how the ticket is issued, from its overrides or else its description.
+// Flexi seasons are smartcard products but are priced differently so are kept apart.
+func (t TicketTypeData) Fulfilment() Fulfilment {
+	if t.fulfilment != "" {
+		return t.fulfilment
+	}
+	desc := strings.ToUpper(t.Description)
+	switch {
+	case strings.Contains(desc, "FLEXI"):
+		return FulfilmentFlexi
+	case strings.HasPrefix(desc, "SMART"):
+		return FulfilmentSmartcard
+	case strings.HasPrefix(desc, "ETKT"), strings.HasPrefix(desc, "E-TKT"), strings.Contains(desc, "BARCODE"):
+		return FulfilmentETicket
+	}
+	return FulfilmentPaper
+}
+
+// IsTravelcard reports whether the ticket includes a London Travelcard on top of the rail journey,
+// from its overrides or else its description
+func (t TicketTypeData) IsTravelcard() bool {
+	if t.travelcard != nil {
+		return *t.travelcard
+	}
+	for _, word := range strings.Fields(strings.ToUpper(t.Description)) {
+		switch {
+		case strings.HasPrefix(word, "TRAVELCARD"), word == "TCD", word == "TC":
+			return true
+		}
+	}
+	return false
+}
+
+// TicketOverrides pins how ticket codes are classified, for codes the description heuristics get wrong
+type TicketOverrides struct {
+	Fulfilment map[string]Fulfilment
+	Travelcard map[string]bool
+}
+
+// Apply returns t with any overrides for its code. t itself is left alone as it may be shared.
+func (o *TicketOverrides) Apply(t *TicketTypeData) *TicketTypeData {
+	fulfilment, hasFulfilment := o.Fulfilment[t.TicketCode]
+	travelcard, hasTravelcard := o.Travelcard[t.TicketCode]
+	if !hasFulfilment && !hasTravelcard {
+		return t
+	}
+	overridden := *t
+	if hasFulfilment {
+		overridden.fulfilment = fulfilment
+	}
+	if hasTravelcard {
+		overridden.travelcard = &travelcard
+	}
+	return &overridden
+}
+
+// TicketCatalogue holds every current ticket type keyed by ticket code
+type TicketCatalogue map[string]*TicketTypeData
+
+// NewTicketCatalogue indexes ticket types by their code
+func NewTicketCatalogue(types []*TicketTypeData) TicketCatalogue {
+	catalogue := make(TicketCatalogue, len(types))
+	for _, t := range types {
+		catalogue[t.TicketCode] = t
+	}
+	return catalogue
+}
+
+// WithOverrides returns a copy of the catalogue with the overrides applied
+func (c TicketCatalogue) WithOverrides(o *TicketOverrides) TicketCatalogue {
+	overridden := make(TicketCatalogue, len(c))
+	for code, t := range c {
+		overridden[code] = o.Apply(t)
+	}
+	return overridden
+}
+
+// Lookup returns the ticket type for a code, or an empty one for codes not in the catalogue
+func (c TicketCatalogue) Lookup(code string) *TicketTypeData {
+	if t, ok := c[code]; ok {
+		return t
+	}
+	return &TicketTypeData{TicketCode: code}
+}
 
-var TicketMappings = map[TicketCode]TicketType{
-	"0AQ": WeeklyStd,
-	"0AS": WeeklyStd,
-	"7DS": WeeklyStd,
-	"7TS": WeeklyZ16TCStd,
+// ForFare returns the ticket type of a fare, falling back to the details joined onto the fare
+func (c TicketCatalogue) ForFare(f *FareDetailExtreme) *TicketTypeData {
+	if t, ok := c[f.TicketCode]; ok {
+		return t
+	}
+	t := f.Ticket()
+	return &t
 }
@@ -0,0 +1,47 @@
+package models
+
+// LocationZoneData is a location with its fare zone and London Underground zone flags
+type LocationZoneData struct {
+	NLC         string
+	CRS         string
+	Description string
+	ZoneNo      string
+	ZoneInd     string
+	LULZone1    string `gorm:"column:lul_zone_1"`
+	LULZone2    string `gorm:"column:lul_zone_2"`
+	LULZone3    string `gorm:"column:lul_zone_3"`
+	LULZone4    string `gorm:"column:lul_zone_4"`
+	LULZone5    string `gorm:"column:lul_zone_5"`
+	LULZone6    string `gorm:"column:lul_zone_6"`
+}
+
+// StationZones is the set of zones a station is in
+type StationZones struct {
+	NLC             string
+	CRS             string
+	Description     string
+	ZoneNo          string
+	ZoneDescription string
+	LULZones        []int
+}
+
+// InLondonZones reports whether the station is inside the Travelcard zones
+func (z StationZones) InLondonZones() bool {
+	return len(z.LULZones) > 0
+}
+
+// NewStationZones flattens the London zone flags into the zone numbers that are set
+func NewStationZones(data *LocationZoneData) *StationZones {
+	zones := &StationZones{
+		NLC:         data.NLC,
+		CRS:         data.CRS,
+		Description: data.Description,
+		ZoneNo:      data.ZoneNo,
+	}
+	for i, flag := range []string{data.LULZone1, data.LULZone2, data.LULZone3, data.LULZone4, data.LULZone5, data.LULZone6} {
+		if flag == "Y" || flag == "1" {
+			zones.LULZones = append(zones.LULZones, i+1)
+		}
+	}
+	return zones
+}
@@ -0,0 +1,541 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const planDateLayout = "2006-01-02"
+
+var (
+	planICal         string
+	planDays         string
+	planStart        string
+	planEnd          string
+	planExclude      []string
+	planHolidaysFile string
+)
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code")
+	planCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code")
+	planCmd.Flags().StringVar(&planICal, "ical", "", "iCal file whose events are the travel days")
+	planCmd.Flags().StringVar(&planDays, "days", "", "Weekdays travelled, e.g. mon,tue,thu")
+	planCmd.Flags().StringVar(&planStart, "start", "", "First date of the --days pattern (YYYY-MM-DD)")
+	planCmd.Flags().StringVar(&planEnd, "end", "", "Last date of the --days pattern (YYYY-MM-DD)")
+	planCmd.Flags().StringSliceVar(&planExclude, "exclude", nil, "Dates not travelled, e.g. holidays (YYYY-MM-DD)")
+	planCmd.Flags().StringVar(&planHolidaysFile, "holidays-file", "", "File of dates not travelled, one YYYY-MM-DD per line")
+	planCmd.MarkFlagRequired("from")
+	planCmd.MarkFlagRequired("to")
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Plan the cheapest tickets to buy for a calendar of travel days",
+	Long: `Takes a list of travel dates, either from an iCal file or a weekday pattern
+between two dates with holidays excluded, and works out the cheapest mix of day
+returns, flexi, weekly, monthly, custom period and annual seasons to cover them.
+
+Daily and weekly recurring iCal events are expanded up to their UNTIL or COUNT,
+other recurrences are refused.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("Arguments", zap.String("from", fromStation), zap.String("to", toStation))
+		if err := plan(cmd.Context(), strings.ToUpper(fromStation), strings.ToUpper(toStation)); err != nil {
+			logger.Error("error running plan", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// Purchase is a single ticket bought as part of a plan
+type Purchase struct {
+	Date       string  `header:"buy_on"`
+	Product    string  `header:"product"`
+	ValidUntil string  `header:"valid_until"`
+	TravelDays int     `header:"travel_days"`
+	Price      float64 `header:"price"`
+}
+
+// Plan is the cheapest set of purchases covering every travel date
+type Plan struct {
+	Purchases []*Purchase
+	Total     float64
+}
+
+// planPrices are the ticket prices available to the planner in pounds, zero where unavailable
+type planPrices struct {
+	DayReturn float64
+	Flexi     float64
+	Seasons   *Fares
+}
+
+// newPlanPrices prices the products a plan can be made from. Any one of them can cover every
+// travel date on its own, so only a route with none of them can't be planned.
+func newPlanPrices(picked *commuteFares) (*planPrices, error) {
+
+	prices := &planPrices{}
+	if picked.anytimeReturn != nil {
+		prices.DayReturn = float64(picked.anytimeReturn.AdultFare) / 100
+	}
+	if picked.flexi != nil {
+		prices.Flexi = float64(picked.flexi.AdultFare) / 100
+	}
+	if picked.weekly != nil {
+		prices.Seasons = calculateFares(picked.weekly.AdultFare)
+	}
+
+	if prices.DayReturn == 0 && prices.Flexi == 0 && prices.Seasons == nil {
+		return nil, errors.New("no return, flexi or season fares found")
+	}
+
+	return prices, nil
+}
+
+// customPeriodPrice prices a season of the given number of days between a month and a year.
+// It is charged pro-rata on the annual price but never less than a monthly season.
+func customPeriodPrice(seasons *Fares, days int) float64 {
+	price := Round(seasons.AnnualStd*float64(days)/365, 0.1)
+	if price < seasons.MonthlyStd {
+		return seasons.MonthlyStd
+	}
+	return price
+}
+
+type planStep struct {
+	cost    float64
+	next    int
+	product string
+	until   time.Time
+	price   float64
+}
+
+// planPurchases finds the cheapest tickets covering every date, which must be sorted and unique
+func planPurchases(dates []time.Time, prices *planPrices) *Plan {
+
+	n := len(dates)
+	best := make([]planStep, n+1)
+
+	// firstAfter returns the index of the first date after end, searching from i
+	firstAfter := func(i int, end time.Time) int {
+		for i < n && !dates[i].After(end) {
+			i++
+		}
+		return i
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		start := dates[i]
+		var options []planStep
+
+		if prices.DayReturn > 0 {
+			options = append(options, planStep{next: i + 1, product: "day return", until: start, price: prices.DayReturn})
+		}
+
+		if prices.Flexi > 0 {
+			end := start.AddDate(0, 0, flexiPeriodDays-1)
+			next := firstAfter(i, end)
+			if next > i+flexiTravelDays {
+				next = i + flexiTravelDays
+			}
+			options = append(options, planStep{next: next, product: "flexi season", until: end, price: prices.Flexi})
+		}
+
+		if seasons := prices.Seasons; seasons != nil {
+			weekEnd := start.AddDate(0, 0, 6)
+			monthEnd := start.AddDate(0, 1, -1)
+			yearEnd := start.AddDate(1, 0, -1)
+
+			options = append(options,
+				planStep{next: firstAfter(i, weekEnd), product: "weekly season", until: weekEnd, price: seasons.WeeklyStd},
+				planStep{next: firstAfter(i, monthEnd), product: "monthly season", until: monthEnd, price: seasons.MonthlyStd},
+				planStep{next: firstAfter(i, yearEnd), product: "annual season", until: yearEnd, price: seasons.AnnualStd},
+			)
+
+			// Custom periods can end on any later travel date between a month and a year away
+			for j := i + 1; j < n && dates[j].Before(yearEnd); j++ {
+				if !dates[j].After(monthEnd) {
+					continue
+				}
+				days := int(dates[j].Sub(start).Hours()/24) + 1
+				options = append(options, planStep{
+					next:    j + 1,
+					product: fmt.Sprintf("custom period season (%d days)", days),
+					until:   dates[j],
+					price:   customPeriodPrice(seasons, days),
+				})
+			}
+		}
+
+		for k, option := range options {
+			option.cost = option.price + best[option.next].cost
+			if k == 0 || option.cost < best[i].cost {
+				best[i] = option
+			}
+		}
+	}
+
+	plan := &Plan{Total: Round(best[0].cost, 0.01)}
+	for i := 0; i < n; i = best[i].next {
+		step := best[i]
+		if step.next <= i {
+			break
+		}
+		plan.Purchases = append(plan.Purchases, &Purchase{
+			Date:       dates[i].Format(planDateLayout),
+			Product:    step.product,
+			ValidUntil: step.until.Format(planDateLayout),
+			TravelDays: step.next - i,
+			Price:      step.price,
+		})
+	}
+
+	return plan
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// datesFromPattern expands a comma separated list of weekdays over an inclusive date range
+func datesFromPattern(pattern string, start, end time.Time) ([]time.Time, error) {
+
+	days := make(map[time.Weekday]bool)
+	for _, d := range strings.Split(pattern, ",") {
+		key := strings.ToLower(strings.TrimSpace(d))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		wd, ok := weekdays[key]
+		if !ok {
+			return nil, errors.Errorf("unknown weekday %q", d)
+		}
+		days[wd] = true
+	}
+
+	var dates []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if days[d.Weekday()] {
+			dates = append(dates, d)
+		}
+	}
+
+	return dates, nil
+}
+
+// datesFromICal reads the date of every event in an iCal file, expanding daily and weekly
+// recurring events and leaving out any EXDATE exceptions
+func datesFromICal(r io.Reader) ([]time.Time, error) {
+
+	var dates []time.Time
+	var start time.Time
+	var rule string
+	var exdates []time.Time
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var err error
+		switch {
+		case line == "BEGIN:VEVENT":
+			start, rule, exdates = time.Time{}, "", nil
+		case strings.HasPrefix(line, "DTSTART"):
+			start, err = parseICalDate(line)
+		case strings.HasPrefix(line, "RRULE:"):
+			rule = strings.TrimPrefix(line, "RRULE:")
+		case strings.HasPrefix(line, "EXDATE"):
+			var d time.Time
+			for _, v := range strings.Split(line[strings.LastIndex(line, ":")+1:], ",") {
+				if d, err = parseICalValue(v); err != nil {
+					break
+				}
+				exdates = append(exdates, d)
+			}
+		case line == "END:VEVENT" && !start.IsZero():
+			occurrences := []time.Time{start}
+			if rule != "" {
+				if occurrences, err = expandRRule(start, rule); err != nil {
+					return nil, errors.Wrapf(err, "expanding RRULE %q", rule)
+				}
+			}
+			dates = append(dates, withoutDates(occurrences, exdates)...)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %q", line)
+		}
+	}
+
+	return dates, scanner.Err()
+}
+
+// parseICalDate reads the date from a DTSTART or similar line, ignoring any time of day
+func parseICalDate(line string) (time.Time, error) {
+	i := strings.LastIndex(line, ":")
+	if i < 0 {
+		return time.Time{}, errors.Errorf("malformed %q", line)
+	}
+	return parseICalValue(line[i+1:])
+}
+
+// parseICalValue reads the date from an iCal DATE or DATE-TIME value
+func parseICalValue(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.Errorf("malformed date %q", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// maxRecurrenceDays stops expanding a rule that would otherwise never reach its COUNT
+const maxRecurrenceDays = 5 * 366
+
+// expandRRule lists the dates of a daily or weekly recurring event, which must end with UNTIL or COUNT.
+// Anything else is refused rather than guessed at so no travel days go missing.
+func expandRRule(start time.Time, rule string) ([]time.Time, error) {
+
+	var freq string
+	var until time.Time
+	interval, count := 1, 0
+	days := make(map[time.Weekday]bool)
+
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("malformed rule part %q", part)
+		}
+
+		var err error
+		switch kv[0] {
+		case "FREQ":
+			freq = kv[1]
+		case "INTERVAL":
+			if interval, err = strconv.Atoi(kv[1]); err == nil && interval < 1 {
+				err = errors.Errorf("INTERVAL must be at least 1, got %v", interval)
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(kv[1]); err == nil && count < 1 {
+				err = errors.Errorf("COUNT must be at least 1, got %v", count)
+			}
+		case "UNTIL":
+			until, err = parseICalValue(kv[1])
+		case "BYDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				wd, ok := icalWeekdays[d]
+				if !ok {
+					return nil, errors.Errorf("unsupported BYDAY %q, only plain weekdays are", d)
+				}
+				days[wd] = true
+			}
+		case "WKST":
+			// Weeks are counted from Monday, the default
+		default:
+			return nil, errors.Errorf("unsupported rule part %s", kv[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", kv[0])
+		}
+	}
+
+	if freq != "DAILY" && freq != "WEEKLY" {
+		return nil, errors.Errorf("only DAILY and WEEKLY events can be expanded, not %q", freq)
+	}
+	if count == 0 && until.IsZero() {
+		return nil, errors.New("the event repeats forever, it needs an UNTIL or COUNT")
+	}
+	if freq == "WEEKLY" && len(days) == 0 {
+		days[start.Weekday()] = true
+	}
+
+	// Monday of the week d is in
+	monday := func(d time.Time) time.Time {
+		return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+	}
+
+	var dates []time.Time
+	for i := 0; i < maxRecurrenceDays; i++ {
+		d := start.AddDate(0, 0, i)
+		if !until.IsZero() && d.After(until) || count > 0 && len(dates) == count {
+			break
+		}
+
+		period := i
+		if freq == "WEEKLY" {
+			period = int(monday(d).Sub(monday(start)).Hours()/24) / 7
+		}
+		if period%interval != 0 || len(days) > 0 && !days[d.Weekday()] {
+			continue
+		}
+
+		dates = append(dates, d)
+	}
+
+	return dates, nil
+}
+
+// withoutDates returns the dates that aren't in exclude
+func withoutDates(dates, exclude []time.Time) []time.Time {
+	var kept []time.Time
+	for _, d := range dates {
+		excluded := false
+		for _, e := range exclude {
+			if d.Equal(e) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+func readDateLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// travelDates builds the sorted, unique list of travel dates from the plan flags
+func travelDates() ([]time.Time, error) {
+
+	var dates []time.Time
+
+	switch {
+	case planICal != "":
+		f, err := os.Open(planICal)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if dates, err = datesFromICal(f); err != nil {
+			return nil, errors.Wrapf(err, "reading %s", planICal)
+		}
+	case planDays != "":
+		start, err := time.Parse(planDateLayout, planStart)
+		if err != nil {
+			return nil, errors.Wrap(err, "--start is required with --days")
+		}
+		end, err := time.Parse(planDateLayout, planEnd)
+		if err != nil {
+			return nil, errors.Wrap(err, "--end is required with --days")
+		}
+		if dates, err = datesFromPattern(planDays, start, end); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("one of --ical or --days is required")
+	}
+
+	exclude := append([]string{}, planExclude...)
+	if planHolidaysFile != "" {
+		f, err := os.Open(planHolidaysFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		lines, err := readDateLines(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", planHolidaysFile)
+		}
+		exclude = append(exclude, lines...)
+	}
+
+	excluded := make(map[string]bool)
+	for _, e := range exclude {
+		if _, err := time.Parse(planDateLayout, e); err != nil {
+			return nil, errors.Wrapf(err, "invalid excluded date %q", e)
+		}
+		excluded[e] = true
+	}
+
+	seen := make(map[string]bool)
+	var result []time.Time
+	for _, d := range dates {
+		key := d.Format(planDateLayout)
+		if excluded[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, d)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Before(result[j])
+	})
+
+	return result, nil
+}
+
+func plan(ctx context.Context, fromStation, toStation string) error {
+
+	dates, err := travelDates()
+	if err != nil {
+		return err
+	}
+
+	if len(dates) == 0 {
+		return errors.New("no travel dates to plan for")
+	}
+
+	repo, err := newRepositoryContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	fares, err := GetFaresContext(ctx, &GetFaresConfig{
+		Repo:        repo,
+		FromStation: fromStation,
+		ToStation:   toStation,
+		Class:       "2",
+	})
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	prices, err := newPlanPrices(pickCommuteFares(fares, catalogue))
+	if err != nil {
+		return errors.Wrapf(err, "planning from %s to %s", fromStation, toStation)
+	}
+
+	p := planPurchases(dates, prices)
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(p.Purchases)
+
+	fmt.Printf("\n%d travel days from %s to %s, total £%.2f\n",
+		len(dates), dates[0].Format(planDateLayout), dates[len(dates)-1].Format(planDateLayout), p.Total)
+	if prices.DayReturn > 0 {
+		fmt.Printf("Day returns for every trip would cost £%.2f\n", Round(prices.DayReturn*float64(len(dates)), 0.01))
+	}
+
+	return nil
+}
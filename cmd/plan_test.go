@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustDate(s string) time.Time {
+	d, err := time.Parse(planDateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func Test_planPurchases(t *testing.T) {
+
+	prices := &planPrices{
+		DayReturn: 16.20,
+		Seasons:   calculateFares(5300),
+	}
+
+	weekdays := func(start, end string) []time.Time {
+		dates, err := datesFromPattern("mon,tue,wed,thu,fri", mustDate(start), mustDate(end))
+		if err != nil {
+			panic(err)
+		}
+		return dates
+	}
+
+	tests := []struct {
+		name         string
+		dates        []time.Time
+		wantProducts []string
+		wantTotal    float64
+	}{
+		{
+			name:         "should buy day returns for occasional trips",
+			dates:        []time.Time{mustDate("2027-01-04"), mustDate("2027-01-12"), mustDate("2027-01-20")},
+			wantProducts: []string{"day return", "day return", "day return"},
+			wantTotal:    48.60,
+		},
+		{
+			name:         "should buy a weekly season for a full week",
+			dates:        weekdays("2027-01-04", "2027-01-08"),
+			wantProducts: []string{"weekly season"},
+			wantTotal:    53,
+		},
+		{
+			name:         "should buy a monthly season for a month of weekdays",
+			dates:        weekdays("2027-01-04", "2027-02-03"),
+			wantProducts: []string{"monthly season"},
+			wantTotal:    203.5,
+		},
+		{
+			name:         "should skip a holiday fortnight with a weekly season either side",
+			dates:        append(weekdays("2027-08-02", "2027-08-06"), weekdays("2027-08-23", "2027-08-27")...),
+			wantProducts: []string{"weekly season", "weekly season"},
+			wantTotal:    106,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planPurchases(tt.dates, prices)
+			var products []string
+			covered := 0
+			for _, p := range got.Purchases {
+				products = append(products, p.Product)
+				covered += p.TravelDays
+			}
+			assert.Equal(t, tt.wantProducts, products)
+			assert.Equal(t, len(tt.dates), covered)
+			assert.InDelta(t, tt.wantTotal, got.Total, 0.001)
+		})
+	}
+}
+
+func Test_newPlanPrices_flexiOnly(t *testing.T) {
+
+	prices, err := newPlanPrices(&commuteFares{flexi: &models.FareDetailExtreme{TicketCode: "FXS", AdultFare: 9000}})
+	assert.NoError(t, err)
+	assert.Equal(t, 90.0, prices.Flexi)
+
+	dates := []time.Time{mustDate("2027-01-04"), mustDate("2027-01-05"), mustDate("2027-02-08")}
+	got := planPurchases(dates, prices)
+	assert.Len(t, got.Purchases, 2)
+	for _, p := range got.Purchases {
+		assert.Equal(t, "flexi season", p.Product)
+	}
+	assert.InDelta(t, 180, got.Total, 0.001)
+
+	_, err = newPlanPrices(&commuteFares{})
+	assert.Error(t, err)
+}
+
+func Test_datesFromICal(t *testing.T) {
+	ical := `BEGIN:VCALENDAR
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20270104
+SUMMARY:Office
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20270106T090000Z
+SUMMARY:Office
+END:VEVENT
+END:VCALENDAR`
+
+	got, err := datesFromICal(strings.NewReader(ical))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{mustDate("2027-01-04"), mustDate("2027-01-06")}, got)
+}
+
+func Test_datesFromICal_recurring(t *testing.T) {
+
+	event := func(rule string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20270104T090000Z\n" + rule + "\nEXDATE;VALUE=DATE:20270111\nEND:VEVENT\nEND:VCALENDAR\n"
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "should expand weekly events on each BYDAY until UNTIL",
+			rule: "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20270113T235959Z",
+			want: []string{"2027-01-04", "2027-01-06", "2027-01-13"},
+		},
+		{
+			name: "should expand fortnightly events",
+			rule: "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+			want: []string{"2027-01-04", "2027-01-18", "2027-02-01"},
+		},
+		{
+			name: "should expand daily events on weekdays to COUNT",
+			rule: "RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=4",
+			want: []string{"2027-01-04", "2027-01-05", "2027-01-06", "2027-01-07"},
+		},
+		{
+			name:    "should refuse monthly events",
+			rule:    "RRULE:FREQ=MONTHLY;COUNT=3",
+			wantErr: `only DAILY and WEEKLY events can be expanded, not "MONTHLY"`,
+		},
+		{
+			name:    "should refuse events that repeat forever",
+			rule:    "RRULE:FREQ=WEEKLY",
+			wantErr: "the event repeats forever, it needs an UNTIL or COUNT",
+		},
+		{
+			name:    "should refuse ordinal weekdays",
+			rule:    "RRULE:FREQ=WEEKLY;BYDAY=1MO;COUNT=2",
+			wantErr: `unsupported BYDAY "1MO", only plain weekdays are`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := datesFromICal(strings.NewReader(event(tt.rule)))
+			if tt.wantErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			var want []time.Time
+			for _, d := range tt.want {
+				want = append(want, mustDate(d))
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// RefundRules are the conditions a surrendered season is refunded under
+type RefundRules struct {
+	AdminFee float64
+	// MinUnexpiredDays is how long must be left on a season of a month or more for any refund
+	MinUnexpiredDays int
+}
+
+var defaultRefundRules = RefundRules{
+	AdminFee:         10,
+	MinUnexpiredDays: 7,
+}
+
+var (
+	refundPrice     float64
+	refundPeriod    string
+	refundStart     string
+	refundSurrender string
+	refundClass     string
+	refundAdminFee  float64
+)
+
+func init() {
+	rootCmd.AddCommand(refundCmd)
+	refundCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code, to price the season")
+	refundCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code, to price the season")
+	refundCmd.Flags().StringVarP(&refundClass, "class", "c", "2", "Class of the season when priced from stations")
+	refundCmd.Flags().Float64Var(&refundPrice, "price", 0, "Price paid for the season in pounds, instead of --from and --to")
+	refundCmd.Flags().StringVar(&refundPeriod, "period", PeriodAnnual, "Season period: weekly, monthly, 3-monthly, 6-monthly, annual or a number of days")
+	refundCmd.Flags().StringVar(&refundStart, "start", "", "First day of the season (YYYY-MM-DD)")
+	refundCmd.Flags().StringVar(&refundSurrender, "surrender", "", "Date the season is handed back (YYYY-MM-DD)")
+	refundCmd.Flags().Float64Var(&refundAdminFee, "admin-fee", defaultRefundRules.AdminFee, "Administration fee deducted from refunds")
+	refundCmd.MarkFlagRequired("start")
+	refundCmd.MarkFlagRequired("surrender")
+}
+
+var refundCmd = &cobra.Command{
+	Use:   "refund",
+	Short: "Calculate the refund for surrendering a season ticket early",
+	Long: `Works out the refund on a season ticket handed back before it expires. The
+days used are charged at the cheapest combination of monthly and weekly seasons,
+an admin fee is deducted, and seasons of a month or more need at least seven
+days left to get anything back.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := refund(cmd.Context()); err != nil {
+			logger.Error("error running refund", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// Refund is the breakdown of a season ticket refund
+type Refund struct {
+	Price         float64
+	UsedDays      int
+	UnexpiredDays int
+	UsedCharge    float64
+	AdminFee      float64
+	Amount        float64
+	Reason        string
+}
+
+// daysBetween counts whole days from a to b, ignoring the time of day
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+// usedPeriodCharge is what the days a season has been used for would have cost, taking the
+// cheapest of whole months plus weeks, or rounding up to the next whole month
+func usedPeriodCharge(seasons *Fares, start, surrender time.Time) float64 {
+
+	// Count whole calendar months used from the start date
+	months := 0
+	for !start.AddDate(0, months+1, 0).After(surrender) {
+		months++
+	}
+
+	remaining := daysBetween(start.AddDate(0, months, 0), surrender)
+	weeks := int(math.Ceil(float64(remaining) / 7))
+
+	monthsAndWeeks := float64(months)*seasons.MonthlyStd + float64(weeks)*seasons.WeeklyStd
+	roundedUp := float64(months) * seasons.MonthlyStd
+	if remaining > 0 {
+		roundedUp += seasons.MonthlyStd
+	}
+
+	return math.Min(monthsAndWeeks, roundedUp)
+}
+
+// calculateRefund applies the refund rules to a season valid from start to end inclusive
+// that is surrendered at the start of the surrender day
+func calculateRefund(seasons *Fares, price float64, start, end, surrender time.Time, rules RefundRules) *Refund {
+
+	r := &Refund{
+		Price:         price,
+		AdminFee:      rules.AdminFee,
+		UnexpiredDays: daysBetween(surrender, end) + 1,
+	}
+
+	if r.UnexpiredDays <= 0 {
+		r.UnexpiredDays = 0
+		r.AdminFee = 0
+		r.Reason = "season has expired"
+		return r
+	}
+
+	if surrender.Before(start) {
+		r.Amount = math.Max(0, Round(price-rules.AdminFee, 0.01))
+		r.Reason = "unused season"
+		return r
+	}
+
+	r.UsedDays = daysBetween(start, surrender)
+	seasonDays := daysBetween(start, end) + 1
+
+	if seasonDays <= 7 {
+		r.AdminFee = 0
+		r.Reason = "weekly seasons are only refunded before they start"
+		return r
+	}
+
+	if r.UnexpiredDays < rules.MinUnexpiredDays {
+		r.AdminFee = 0
+		r.Reason = fmt.Sprintf("less than %d days unexpired", rules.MinUnexpiredDays)
+		return r
+	}
+
+	r.UsedCharge = Round(usedPeriodCharge(seasons, start, surrender), 0.01)
+	r.Amount = math.Max(0, Round(price-r.UsedCharge-rules.AdminFee, 0.01))
+	if r.Amount == 0 {
+		r.Reason = "used period costs more than the season"
+	}
+
+	return r
+}
+
+func refund(ctx context.Context) error {
+
+	start, err := time.Parse(planDateLayout, refundStart)
+	if err != nil {
+		return errors.Wrap(err, "invalid --start")
+	}
+
+	surrender, err := time.Parse(planDateLayout, refundSurrender)
+	if err != nil {
+		return errors.Wrap(err, "invalid --surrender")
+	}
+
+	end, err := seasonEnd(start, refundPeriod)
+	if err != nil {
+		return err
+	}
+
+	var seasons *Fares
+	price := refundPrice
+
+	switch {
+	case fromStation != "" && toStation != "":
+		seasons, price, err = priceSeason(ctx, strings.ToUpper(fromStation), strings.ToUpper(toStation), refundClass, refundPeriod)
+	case refundPrice > 0:
+		seasons, err = seasonsFromPrice(refundPrice, refundPeriod)
+	default:
+		err = errors.New("either --price or both --from and --to are required")
+	}
+	if err != nil {
+		return err
+	}
+
+	rules := defaultRefundRules
+	rules.AdminFee = refundAdminFee
+
+	r := calculateRefund(seasons, price, start, end, surrender, rules)
+
+	fmt.Printf("Season:          %s from %s to %s\n", refundPeriod, start.Format(planDateLayout), end.Format(planDateLayout))
+	fmt.Printf("Price paid:      £%.2f\n", r.Price)
+	fmt.Printf("Days used:       %d\n", r.UsedDays)
+	fmt.Printf("Days unexpired:  %d\n", r.UnexpiredDays)
+	fmt.Printf("Used period:     £%.2f\n", r.UsedCharge)
+	fmt.Printf("Admin fee:       £%.2f\n", r.AdminFee)
+	fmt.Printf("Refund:          £%.2f\n", r.Amount)
+	if r.Reason != "" {
+		fmt.Printf("Note:            %s\n", r.Reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_calculateRefund(t *testing.T) {
+
+	seasons := calculateFares(5300)
+
+	tests := []struct {
+		name       string
+		price      float64
+		start      string
+		end        string
+		surrender  string
+		wantAmount float64
+		wantCharge float64
+		wantReason string
+	}{
+		{
+			name:       "should charge used months and weeks on an annual season",
+			price:      2120,
+			start:      "2027-01-04",
+			end:        "2028-01-03",
+			surrender:  "2027-04-15",
+			wantAmount: 1393.5,
+			wantCharge: 716.5,
+		},
+		{
+			name:       "should round the used period up to a month when cheaper",
+			price:      2120,
+			start:      "2027-01-04",
+			end:        "2028-01-03",
+			surrender:  "2027-01-31",
+			wantAmount: 1906.5,
+			wantCharge: 203.5,
+		},
+		{
+			name:       "should refund all but the admin fee before the season starts",
+			price:      2120,
+			start:      "2027-01-04",
+			end:        "2028-01-03",
+			surrender:  "2027-01-01",
+			wantAmount: 2110,
+			wantReason: "unused season",
+		},
+		{
+			name:       "should not refund with less than the minimum unexpired period",
+			price:      2120,
+			start:      "2027-01-04",
+			end:        "2028-01-03",
+			surrender:  "2027-12-30",
+			wantReason: "less than 7 days unexpired",
+		},
+		{
+			name:       "should not refund a weekly season once started",
+			price:      53,
+			start:      "2027-01-04",
+			end:        "2027-01-10",
+			surrender:  "2027-01-05",
+			wantReason: "weekly seasons are only refunded before they start",
+		},
+		{
+			name:       "should not refund an expired season",
+			price:      203.5,
+			start:      "2027-01-04",
+			end:        "2027-02-03",
+			surrender:  "2027-03-01",
+			wantReason: "season has expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateRefund(seasons, tt.price, mustDate(tt.start), mustDate(tt.end), mustDate(tt.surrender), defaultRefundRules)
+			assert.InDelta(t, tt.wantAmount, got.Amount, 0.001)
+			assert.InDelta(t, tt.wantCharge, got.UsedCharge, 0.001)
+			assert.Equal(t, tt.wantReason, got.Reason)
+		})
+	}
+}
+
+func Test_calculateRefund_customPeriodFromPrice(t *testing.T) {
+
+	start := mustDate("2026-01-01")
+	end, err := seasonEnd(start, "200")
+	assert.NoError(t, err)
+
+	seasons, err := seasonsFromPrice(2000, "200")
+	assert.NoError(t, err)
+
+	got := calculateRefund(seasons, 2000, start, end, mustDate("2026-03-01"), defaultRefundRules)
+	assert.Equal(t, "", got.Reason)
+	// Two months used at the monthly season derived from the equivalent annual price
+	assert.InDelta(t, 700.8, got.UsedCharge, 0.001)
+	assert.InDelta(t, 1289.2, got.Amount, 0.001)
+}
@@ -1,29 +1,31 @@
 package repository
 
 import (
+	"context"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/geo"
 	"github.com/jdheyburn/stc/cmd/models"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
-// var logger, _ = zap.NewDevelopment()
-var logger *zap.SugaredLogger
-
-func init() {
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	slogger, _ := config.Build()
-	logger = slogger.Sugar()
-}
-
 // DtdRepository provides an abstraction between databases
 type DtdRepository interface {
-	FindStationsByCrs(crs string) (*models.LocationData, error)
-	FindFlowsForStations(src, dst string) ([]*models.FlowData, error)
-	FindAllFlowsForStation(nlc string) ([]*models.FlowData, error)
+	FindStationsByCrs(crs string) ([]*models.LocationData, error)
+	FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error)
+	FindGroupMembers(groupUic string) ([]*models.LocationData, error)
+	FindFlowsForStations(src, dst string) ([]*models.FlowDetail, error)
+	FindAllFlowsForStation(nlc string) ([]*models.FlowDetail, error)
 	FindFaresForFlows(flowIds []string) ([]*models.FareDetail, error)
-	FindFaresForNLCs(srcNlcs, dstNlcs []string) ([]*models.FareDetailExtreme, error)
+	FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) ([]*models.FareDetailExtreme, error)
 	FindFareOverridesForNLCs(srcNlcs, dstNlcs []string) ([]*models.FareDetailExtreme, error)
-	FindNLCsRelatedToCrs(crs string) ([]string, error)
+	FindNLCsRelatedToCrs(crs string) ([]*models.RelatedNLC, error)
+	FindLocationNamesByNLCs(nlcs []string) (map[string]string, error)
+	FindZonesForCrs(crs string) (*models.StationZones, error)
+	FindTicketTypes() ([]*models.TicketTypeData, error)
+	FindTicketCatalogue() (models.TicketCatalogue, error)
 	FindFlowsForNLCs(srcNlcs []string, dstNlcs []string) ([]*models.FlowDetail, error)
+	FindFareHistory(srcNlcs, dstNlcs, ticketCodes []string, since, until time.Time) ([]*models.FareHistoryData, error)
+	FindStationGeo(crs string) (*models.StationGeoData, error)
+	FindStationsNear(p geo.Point, radiusKm float64, limit int) ([]*models.StationGeoDetail, error)
+	WithContext(ctx context.Context) DtdRepository
 }
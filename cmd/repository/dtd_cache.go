@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCacheEntries bounds the cache, which is emptied if it fills up with unexpired entries
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache holds values for a fixed time after they are stored
+type ttlCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, entries: map[string]cacheEntry{}, now: time.Now}
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = map[string]cacheEntry{}
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// CachedRepository caches the station, NLC, ticket type and fare lookups made by GetFares,
+// passing every other call through to the repository it wraps. Results are kept for the
+// whole ttl, so lookups can still answer from the previous dataset for up to ttl after
+// another is activated.
+type CachedRepository struct {
+	DtdRepository
+	cache    *ttlCache
+	requests *prometheus.CounterVec
+}
+
+var _ DtdRepository = &CachedRepository{}
+
+// NewCachedRepository wraps a repository with a cache of results kept for ttl, registering
+// its hit and miss counts with reg
+func NewCachedRepository(next DtdRepository, ttl time.Duration, reg prometheus.Registerer) (*CachedRepository, error) {
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "stc",
+		Subsystem: "repository",
+		Name:      "cache_requests_total",
+		Help:      "Cached repository lookups by method and whether they were a hit or miss.",
+	}, []string{"method", "result"})
+
+	if err := reg.Register(requests); err != nil {
+		return nil, err
+	}
+
+	return &CachedRepository{DtdRepository: next, cache: newTTLCache(ttl), requests: requests}, nil
+}
+
+// WithContext shares the cache with the returned repository, which only passes ctx on
+// to the lookups it has to make
+func (r *CachedRepository) WithContext(ctx context.Context) DtdRepository {
+	return &CachedRepository{DtdRepository: r.DtdRepository.WithContext(ctx), cache: r.cache, requests: r.requests}
+}
+
+// cached returns the stored result for a method and its arguments, or loads and stores it.
+// Errors are not cached.
+func (r *CachedRepository) cached(method string, args []interface{}, load func() (interface{}, error)) (interface{}, error) {
+
+	key := method + fmt.Sprint(args...)
+	if v, ok := r.cache.get(key); ok {
+		r.requests.WithLabelValues(method, "hit").Inc()
+		return v, nil
+	}
+
+	r.requests.WithLabelValues(method, "miss").Inc()
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.set(key, v)
+	return v, nil
+}
+
+// copyFares stops callers annotating fares from changing the cached copies
+func copyFares(fares []*models.FareDetailExtreme) []*models.FareDetailExtreme {
+	copied := make([]*models.FareDetailExtreme, len(fares))
+	for i, f := range fares {
+		c := *f
+		copied[i] = &c
+	}
+	return copied
+}
+
+// copyStation stops callers changing the cached station or its groups
+func copyStation(station *models.LocationWithGroups) *models.LocationWithGroups {
+	c := *station
+	c.Groups = make([]*models.LocationGroup, len(station.Groups))
+	for i, g := range station.Groups {
+		group := *g
+		c.Groups[i] = &group
+	}
+	return &c
+}
+
+// copyRelatedNLCs stops callers changing the cached NLCs
+func copyRelatedNLCs(nlcs []*models.RelatedNLC) []*models.RelatedNLC {
+	copied := make([]*models.RelatedNLC, len(nlcs))
+	for i, n := range nlcs {
+		c := *n
+		copied[i] = &c
+	}
+	return copied
+}
+
+func (r *CachedRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	v, err := r.cached("FindStationWithGroupsByCrs", []interface{}{crs}, func() (interface{}, error) {
+		return r.DtdRepository.FindStationWithGroupsByCrs(crs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyStation(v.(*models.LocationWithGroups)), nil
+}
+
+func (r *CachedRepository) FindNLCsRelatedToCrs(crs string) ([]*models.RelatedNLC, error) {
+	v, err := r.cached("FindNLCsRelatedToCrs", []interface{}{crs}, func() (interface{}, error) {
+		return r.DtdRepository.FindNLCsRelatedToCrs(crs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyRelatedNLCs(v.([]*models.RelatedNLC)), nil
+}
+
+func (r *CachedRepository) FindTicketCatalogue() (models.TicketCatalogue, error) {
+	v, err := r.cached("FindTicketCatalogue", nil, func() (interface{}, error) {
+		return r.DtdRepository.FindTicketCatalogue()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(models.TicketCatalogue), nil
+}
+
+func (r *CachedRepository) FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) ([]*models.FareDetailExtreme, error) {
+	args := []interface{}{strings.Join(srcNlcs, ","), "|", strings.Join(dstNlcs, ","), "|", season, "|", class}
+	v, err := r.cached("FindFaresForNLCs", args, func() (interface{}, error) {
+		return r.DtdRepository.FindFaresForNLCs(srcNlcs, dstNlcs, season, class)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyFares(v.([]*models.FareDetailExtreme)), nil
+}
+
+func (r *CachedRepository) FindFareOverridesForNLCs(srcNlcs, dstNlcs []string) ([]*models.FareDetailExtreme, error) {
+	args := []interface{}{strings.Join(srcNlcs, ","), "|", strings.Join(dstNlcs, ",")}
+	v, err := r.cached("FindFareOverridesForNLCs", args, func() (interface{}, error) {
+		return r.DtdRepository.FindFareOverridesForNLCs(srcNlcs, dstNlcs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyFares(v.([]*models.FareDetailExtreme)), nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepository answers fare lookups and counts how often it was asked
+type countingRepository struct {
+	DtdRepository
+	calls int
+	err   error
+}
+
+func (r *countingRepository) FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) ([]*models.FareDetailExtreme, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []*models.FareDetailExtreme{{TicketCode: "7DS", AdultFare: 5000}}, nil
+}
+
+func (r *countingRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	r.calls++
+	return &models.LocationWithGroups{CRS: crs, Groups: []*models.LocationGroup{{UIC: "7015990", Description: "LONDON GROUP"}}}, nil
+}
+
+func (r *countingRepository) FindNLCsRelatedToCrs(crs string) ([]*models.RelatedNLC, error) {
+	r.calls++
+	return []*models.RelatedNLC{{NLC: "5598", Source: "station"}}, nil
+}
+
+func TestCachedRepository(t *testing.T) {
+
+	next := &countingRepository{}
+	reg := prometheus.NewRegistry()
+	repo, err := NewCachedRepository(next, time.Minute, reg)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	repo.cache.now = func() time.Time { return now }
+
+	first, err := repo.FindFaresForNLCs([]string{"5598"}, []string{"1072"}, true, "2")
+	assert.NoError(t, err)
+	first[0].OriginVia = "changed by caller"
+
+	second, err := repo.FindFaresForNLCs([]string{"5598"}, []string{"1072"}, true, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, next.calls)
+	assert.Equal(t, "", second[0].OriginVia, "cached fares should be copies")
+
+	_, err = repo.FindFaresForNLCs([]string{"5598"}, []string{"1072"}, true, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, next.calls)
+
+	now = now.Add(2 * time.Minute)
+	_, err = repo.FindFaresForNLCs([]string{"5598"}, []string{"1072"}, true, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, next.calls, "expired entries should be reloaded")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(repo.requests.WithLabelValues("FindFaresForNLCs", "hit")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(repo.requests.WithLabelValues("FindFaresForNLCs", "miss")))
+}
+
+func TestCachedRepository_stationsCopied(t *testing.T) {
+
+	next := &countingRepository{}
+	repo, err := NewCachedRepository(next, time.Minute, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	station, err := repo.FindStationWithGroupsByCrs("WAT")
+	assert.NoError(t, err)
+	station.Description = "changed by caller"
+	station.Groups[0].Description = "changed by caller"
+
+	nlcs, err := repo.FindNLCsRelatedToCrs("WOK")
+	assert.NoError(t, err)
+	nlcs[0].NLC = "changed by caller"
+
+	station, err = repo.FindStationWithGroupsByCrs("WAT")
+	assert.NoError(t, err)
+	assert.Equal(t, "", station.Description)
+	assert.Equal(t, "LONDON GROUP", station.Groups[0].Description)
+
+	nlcs, err = repo.FindNLCsRelatedToCrs("WOK")
+	assert.NoError(t, err)
+	assert.Equal(t, "5598", nlcs[0].NLC)
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestCachedRepository_errorsNotCached(t *testing.T) {
+
+	next := &countingRepository{err: ErrNotFound}
+	repo, err := NewCachedRepository(next, time.Minute, prometheus.NewRegistry())
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = repo.FindFaresForNLCs(nil, nil, false, "2")
+		assert.Equal(t, ErrNotFound, err)
+	}
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestInstrumentedRepository(t *testing.T) {
+
+	next := &countingRepository{}
+	reg := prometheus.NewRegistry()
+	repo, err := NewInstrumentedRepository(next, reg)
+	assert.NoError(t, err)
+
+	_, err = repo.FindFaresForNLCs(nil, nil, false, "2")
+	assert.NoError(t, err)
+
+	next.err = ErrNotFound
+	_, err = repo.FindFaresForNLCs(nil, nil, false, "2")
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(repo.duration))
+	assert.Equal(t, 1, testutil.CollectAndCount(repo.duration.WithLabelValues("FindFaresForNLCs", "not_found").(prometheus.Histogram)))
+}
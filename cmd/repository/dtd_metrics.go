@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/geo"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentedRepository records the latency of every call to the DtdRepository it wraps
+type InstrumentedRepository struct {
+	next     DtdRepository
+	duration *prometheus.HistogramVec
+}
+
+var _ DtdRepository = &InstrumentedRepository{}
+
+// NewInstrumentedRepository wraps a repository, registering its metrics with reg
+func NewInstrumentedRepository(next DtdRepository, reg prometheus.Registerer) (*InstrumentedRepository, error) {
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "stc",
+		Subsystem: "repository",
+		Name:      "query_duration_seconds",
+		Help:      "Time taken by each repository method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "outcome"})
+
+	if err := reg.Register(duration); err != nil {
+		return nil, err
+	}
+
+	return &InstrumentedRepository{next: next, duration: duration}, nil
+}
+
+func (r *InstrumentedRepository) observe(method string, start time.Time, err error) {
+	outcome := "success"
+	switch {
+	case errors.Cause(err) == ErrNotFound:
+		outcome = "not_found"
+	case IsTimeout(err):
+		outcome = "timeout"
+	case IsCanceled(err):
+		outcome = "canceled"
+	case err != nil:
+		outcome = "error"
+	}
+	r.duration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
+
+func (r *InstrumentedRepository) FindStationsByCrs(crs string) (res []*models.LocationData, err error) {
+	defer func(start time.Time) { r.observe("FindStationsByCrs", start, err) }(time.Now())
+	return r.next.FindStationsByCrs(crs)
+}
+
+func (r *InstrumentedRepository) FindStationWithGroupsByCrs(crs string) (res *models.LocationWithGroups, err error) {
+	defer func(start time.Time) { r.observe("FindStationWithGroupsByCrs", start, err) }(time.Now())
+	return r.next.FindStationWithGroupsByCrs(crs)
+}
+
+func (r *InstrumentedRepository) FindGroupMembers(groupUic string) (res []*models.LocationData, err error) {
+	defer func(start time.Time) { r.observe("FindGroupMembers", start, err) }(time.Now())
+	return r.next.FindGroupMembers(groupUic)
+}
+
+func (r *InstrumentedRepository) FindFlowsForStations(src, dst string) (res []*models.FlowDetail, err error) {
+	defer func(start time.Time) { r.observe("FindFlowsForStations", start, err) }(time.Now())
+	return r.next.FindFlowsForStations(src, dst)
+}
+
+func (r *InstrumentedRepository) FindAllFlowsForStation(nlc string) (res []*models.FlowDetail, err error) {
+	defer func(start time.Time) { r.observe("FindAllFlowsForStation", start, err) }(time.Now())
+	return r.next.FindAllFlowsForStation(nlc)
+}
+
+func (r *InstrumentedRepository) FindFaresForFlows(flowIds []string) (res []*models.FareDetail, err error) {
+	defer func(start time.Time) { r.observe("FindFaresForFlows", start, err) }(time.Now())
+	return r.next.FindFaresForFlows(flowIds)
+}
+
+func (r *InstrumentedRepository) FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) (res []*models.FareDetailExtreme, err error) {
+	defer func(start time.Time) { r.observe("FindFaresForNLCs", start, err) }(time.Now())
+	return r.next.FindFaresForNLCs(srcNlcs, dstNlcs, season, class)
+}
+
+func (r *InstrumentedRepository) FindFareOverridesForNLCs(srcNlcs, dstNlcs []string) (res []*models.FareDetailExtreme, err error) {
+	defer func(start time.Time) { r.observe("FindFareOverridesForNLCs", start, err) }(time.Now())
+	return r.next.FindFareOverridesForNLCs(srcNlcs, dstNlcs)
+}
+
+func (r *InstrumentedRepository) FindNLCsRelatedToCrs(crs string) (res []*models.RelatedNLC, err error) {
+	defer func(start time.Time) { r.observe("FindNLCsRelatedToCrs", start, err) }(time.Now())
+	return r.next.FindNLCsRelatedToCrs(crs)
+}
+
+func (r *InstrumentedRepository) FindLocationNamesByNLCs(nlcs []string) (res map[string]string, err error) {
+	defer func(start time.Time) { r.observe("FindLocationNamesByNLCs", start, err) }(time.Now())
+	return r.next.FindLocationNamesByNLCs(nlcs)
+}
+
+func (r *InstrumentedRepository) FindZonesForCrs(crs string) (res *models.StationZones, err error) {
+	defer func(start time.Time) { r.observe("FindZonesForCrs", start, err) }(time.Now())
+	return r.next.FindZonesForCrs(crs)
+}
+
+func (r *InstrumentedRepository) FindTicketTypes() (res []*models.TicketTypeData, err error) {
+	defer func(start time.Time) { r.observe("FindTicketTypes", start, err) }(time.Now())
+	return r.next.FindTicketTypes()
+}
+
+func (r *InstrumentedRepository) FindTicketCatalogue() (res models.TicketCatalogue, err error) {
+	defer func(start time.Time) { r.observe("FindTicketCatalogue", start, err) }(time.Now())
+	return r.next.FindTicketCatalogue()
+}
+
+func (r *InstrumentedRepository) FindFlowsForNLCs(srcNlcs []string, dstNlcs []string) (res []*models.FlowDetail, err error) {
+	defer func(start time.Time) { r.observe("FindFlowsForNLCs", start, err) }(time.Now())
+	return r.next.FindFlowsForNLCs(srcNlcs, dstNlcs)
+}
+
+func (r *InstrumentedRepository) FindFareHistory(srcNlcs, dstNlcs, ticketCodes []string, since, until time.Time) (res []*models.FareHistoryData, err error) {
+	defer func(start time.Time) { r.observe("FindFareHistory", start, err) }(time.Now())
+	return r.next.FindFareHistory(srcNlcs, dstNlcs, ticketCodes, since, until)
+}
+
+func (r *InstrumentedRepository) FindStationGeo(crs string) (res *models.StationGeoData, err error) {
+	defer func(start time.Time) { r.observe("FindStationGeo", start, err) }(time.Now())
+	return r.next.FindStationGeo(crs)
+}
+
+func (r *InstrumentedRepository) FindStationsNear(p geo.Point, radiusKm float64, limit int) (res []*models.StationGeoDetail, err error) {
+	defer func(start time.Time) { r.observe("FindStationsNear", start, err) }(time.Now())
+	return r.next.FindStationsNear(p, radiusKm, limit)
+}
+
+// WithContext keeps recording latency for the repository bound to ctx
+func (r *InstrumentedRepository) WithContext(ctx context.Context) DtdRepository {
+	return &InstrumentedRepository{next: r.next.WithContext(ctx), duration: r.duration}
+}
@@ -2,15 +2,17 @@ package repository
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jdheyburn/stc/cmd/models"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	glogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
 )
 
 // ErrNotFound is returned when a record cannot be found
@@ -19,15 +21,37 @@ var ErrNotFound = errors.New("not found")
 // DBOptions holds the information required to construct a DB connection
 type DtdSqlDBOptions struct {
 	Host, Port, User, Password, DBName string
+	// QueryTimeout bounds each lookup, zero leaves them bounded only by their context
+	QueryTimeout time.Duration
+	// Logger receives the repository's logs and GORM's, which logs every statement at debug level
+	Logger *zap.Logger
+	// SlowQueryThreshold is how long a statement can take before GORM warns about it, zero never warns
+	SlowQueryThreshold time.Duration
 }
 
 // DtdRepositorySql is a concrete MySql implementation of a DtdRepository
 type DtdRepositorySql struct {
-	db *gorm.DB
+	db           *gorm.DB
+	queryTimeout time.Duration
+	log          *zap.SugaredLogger
 }
 
+var nopLogger = zap.NewNop().Sugar()
+
+// logger falls back to discarding logs for repositories built without NewDtdRepositorySql
+func (dtd *DtdRepositorySql) logger() *zap.SugaredLogger {
+	if dtd.log == nil {
+		return nopLogger
+	}
+	return dtd.log
+}
+
+var _ DtdRepository = &DtdRepositorySql{}
+
 func NewDtdRepositorySql(options *DtdSqlDBOptions) (*DtdRepositorySql, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+	// clientFoundRows makes an UPDATE report the rows it matched rather than the rows it changed,
+	// so amending a record to the values it already has isn't mistaken for it not existing
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true",
 		options.User,
 		options.Password,
 		options.Host,
@@ -35,13 +59,16 @@ func NewDtdRepositorySql(options *DtdSqlDBOptions) (*DtdRepositorySql, error) {
 		options.DBName,
 	)
 
-	dbLogger := glogger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		glogger.Config{
-			LogLevel: glogger.Info,
-			Colorful: true,
-		},
-	)
+	log := options.Logger
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	dbLogger := zapgorm2.New(log.Named("gorm"))
+	dbLogger.SlowThreshold = options.SlowQueryThreshold
+	if log.Core().Enabled(zapcore.DebugLevel) {
+		dbLogger.LogLevel = glogger.Info
+	}
 
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger: dbLogger,
@@ -51,19 +78,28 @@ func NewDtdRepositorySql(options *DtdSqlDBOptions) (*DtdRepositorySql, error) {
 		return nil, errors.Wrap(err, "creating sql conn")
 	}
 
-	fmt.Println("Successfully connected!")
+	if err := db.Use(&tracingPlugin{}); err != nil {
+		return nil, errors.Wrap(err, "registering tracing callbacks")
+	}
+
+	log.Info("connected to fares database", zap.String("host", options.Host), zap.String("db", options.DBName))
 
 	return &DtdRepositorySql{
-		db: db,
+		db:           db,
+		queryTimeout: options.QueryTimeout,
+		log:          log.Sugar(),
 	}, nil
 }
 
 // FindStationsByCrs returns locations from the given CRS code
 func (dtd *DtdRepositorySql) FindStationsByCrs(crs string) (stations []*models.LocationData, err error) {
 
-	logger.Infof("looking up CRS %v", crs)
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
 
-	err = dtd.db.Unscoped().
+	dtd.logger().Infof("looking up CRS %v", crs)
+
+	err = db.Unscoped().
 		Select("uic", "nlc", "description", "crs", "fare_group", "start_date", "end_date").
 		Where("crs = ?", crs).
 		Where("start_date <= CURDATE()").
@@ -76,31 +112,176 @@ func (dtd *DtdRepositorySql) FindStationsByCrs(crs string) (stations []*models.L
 	}
 
 	if len(stations) > 0 {
-		logger.Infof("found %v from crs %v", stations[0].Description, crs)
+		dtd.logger().Infof("found %v from crs %v", stations[0].Description, crs)
 		return stations, nil
 	}
 
 	return nil, ErrNotFound
 }
 
-func (dtd *DtdRepositorySql) FindNLCsRelatedToCrs(crs string) (nlcs []string, err error) {
+// FindStationWithGroupsByCrs returns the location for a CRS code along with every group it belongs to
+func (dtd *DtdRepositorySql) FindStationWithGroupsByCrs(crs string) (station *models.LocationWithGroups, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
 
-	logger.Infof("looking up NLCs related to CRS %v", crs)
+	dtd.logger().Infof("looking up CRS %v with groups", crs)
 
-	err = dtd.db.Raw(nlcs_query, crs, crs).Scan(&nlcs).Error
+	var rows []*models.LocationWithGroupData
+	err = db.Raw(station_with_groups_query, crs).Scan(&rows).Error
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying for location with groups %s", crs)
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	station = &models.LocationWithGroups{
+		UIC:         rows[0].UIC,
+		NLC:         rows[0].NLC,
+		CRS:         rows[0].CRS,
+		FareGroup:   rows[0].FareGroup,
+		Description: rows[0].Description,
+		StartDate:   rows[0].StartDate,
+		EndDate:     rows[0].EndDate,
+	}
+
+	// Stations outside of any group come back as a single row with no group columns
+	for _, row := range rows {
+		if row.GroupUicCode == "" {
+			continue
+		}
+		station.Groups = append(station.Groups, &models.LocationGroup{
+			UIC:         row.GroupUicCode,
+			Description: row.GroupDescription,
+		})
+	}
+
+	dtd.logger().Infof("found %v in %v groups from crs %v", station.Description, len(station.Groups), crs)
+
+	return station, nil
+}
+
+// FindGroupMembers returns the current member stations of the group with the given UIC code
+func (dtd *DtdRepositorySql) FindGroupMembers(groupUic string) (members []*models.LocationData, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up members of group %v", groupUic)
+
+	err = db.Raw(group_members_query, groupUic).Scan(&members).Error
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying for members of group %s", groupUic)
+	}
+
+	if len(members) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return members, nil
+}
+
+// FindZonesForCrs returns the fare zone and London Travelcard zones of a station
+func (dtd *DtdRepositorySql) FindZonesForCrs(crs string) (zones *models.StationZones, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up zones for CRS %v", crs)
+
+	var rows []*models.LocationZoneData
+	err = db.Raw(zones_query, crs).Scan(&rows).Error
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying for zones of %s", crs)
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	zones = models.NewStationZones(rows[0])
+
+	if zones.ZoneNo != "" {
+		names, err := dtd.FindLocationNamesByNLCs([]string{zones.ZoneNo})
+		if err != nil {
+			return nil, err
+		}
+		zones.ZoneDescription = names[zones.ZoneNo]
+	}
+
+	return zones, nil
+}
+
+// FindNLCsRelatedToCrs returns every NLC fares can be priced from for a CRS, with the rule that linked it
+func (dtd *DtdRepositorySql) FindNLCsRelatedToCrs(crs string) (nlcs []*models.RelatedNLC, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up NLCs related to CRS %v", crs)
+
+	var rows []*models.RelatedNLC
+	err = db.Raw(nlcs_query, crs, crs).Scan(&rows).Error
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "querying for NLCs related to CRS %s", crs)
 	}
 
+	// Rows are ordered most specific first, so the first source seen for an NLC wins
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if row.NLC == "" || seen[row.NLC] {
+			continue
+		}
+		seen[row.NLC] = true
+		nlcs = append(nlcs, row)
+	}
+
 	return nlcs, nil
 }
 
+// FindLocationNamesByNLCs returns the current description of each NLC that is a location
+func (dtd *DtdRepositorySql) FindLocationNamesByNLCs(nlcs []string) (names map[string]string, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up names for %v NLCs", len(nlcs))
+
+	var locations []*models.LocationData
+	err = db.Unscoped().
+		Select("nlc", "description").
+		Where("nlc IN ?", nlcs).
+		Where("start_date <= CURDATE()").
+		Where("end_date > CURDATE()").
+		Find(&locations).
+		Error
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying for location names")
+	}
+
+	names = make(map[string]string, len(locations))
+	for _, l := range locations {
+		names[l.NLC] = l.Description
+	}
+
+	return names, nil
+}
+
 func (dtd *DtdRepositorySql) FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) (fares []*models.FareDetailExtreme, err error) {
 
-	logger.Infof("looking up fares related to nlcs")
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
 
-	err = dtd.db.Raw(fares_query, srcNlcs, dstNlcs, dstNlcs, srcNlcs).Scan(&fares).Error
+	dtd.logger().Infof("looking up fares related to nlcs")
+
+	err = db.Raw(fares_query, class, srcNlcs, dstNlcs, dstNlcs, srcNlcs).Scan(&fares).Error
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "querying for fares related to nlcs")
@@ -110,7 +291,7 @@ func (dtd *DtdRepositorySql) FindFaresForNLCs(srcNlcs, dstNlcs []string, season
 	if season {
 		var filtered []*models.FareDetailExtreme
 		for _, fare := range fares {
-			if fare.TicketType == "N" {
+			if fare.Ticket().IsSeason() {
 				filtered = append(filtered, fare)
 			}
 		}
@@ -122,9 +303,12 @@ func (dtd *DtdRepositorySql) FindFaresForNLCs(srcNlcs, dstNlcs []string, season
 
 func (dtd *DtdRepositorySql) FindFareOverridesForNLCs(srcNlcs, dstNlcs []string) (fares []*models.FareDetailExtreme, err error) {
 
-	logger.Infof("looking up fares overrides related to nlcs")
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up fares overrides related to nlcs")
 
-	err = dtd.db.Raw(nfo_query, srcNlcs, dstNlcs).Scan(&fares).Error
+	err = db.Raw(nfo_query, srcNlcs, dstNlcs).Scan(&fares).Error
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "querying for fares overrides related to nlcs")
@@ -135,9 +319,12 @@ func (dtd *DtdRepositorySql) FindFareOverridesForNLCs(srcNlcs, dstNlcs []string)
 
 func (dtd *DtdRepositorySql) FindFlowsForNLCs(srcNlcs []string, dstNlcs []string) (flows []*models.FlowDetail, err error) {
 
-	logger.Infof("looking up flows matching src and dst NLCs")
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up flows matching src and dst NLCs")
 
-	err = dtd.db.Unscoped().Model(&models.FlowData{}).
+	err = db.Unscoped().Model(&models.FlowData{}).
 		Select(
 			"flow.flow_id",
 			"flow.origin_code",
@@ -150,9 +337,9 @@ func (dtd *DtdRepositorySql) FindFlowsForNLCs(srcNlcs []string, dstNlcs []string
 		).
 		Joins("LEFT JOIN route on flow.route_code = route.route_code").
 		Where(
-			dtd.db.Where("flow.origin_code in ?", srcNlcs).Where("flow.destination_code in ?", dstNlcs),
+			db.Where("flow.origin_code in ?", srcNlcs).Where("flow.destination_code in ?", dstNlcs),
 		).
-		Or(dtd.db.Where("flow.origin_code in ?", dstNlcs).Where("flow.destination_code in ?", srcNlcs).Where("flow.direction = 'R'")).
+		Or(db.Where("flow.origin_code in ?", dstNlcs).Where("flow.destination_code in ?", srcNlcs).Where("flow.direction = 'R'")).
 		Where("flow.start_date <= CURDATE()").
 		Where("flow.end_date > CURDATE()").
 		Where("route.start_date <= CURDATE()").
@@ -166,9 +353,9 @@ func (dtd *DtdRepositorySql) FindFlowsForNLCs(srcNlcs []string, dstNlcs []string
 	return flows, nil
 }
 
-func (dtd *DtdRepositorySql) findFlows(src, dst string, reversed bool) (flows []*models.FlowDetail, err error) {
+func findFlows(db *gorm.DB, src, dst string, reversed bool) (flows []*models.FlowDetail, err error) {
 
-	chain := dtd.db.Unscoped().Model(&models.FlowData{}).
+	chain := db.Unscoped().Model(&models.FlowData{}).
 		Select(
 			"flow.flow_id",
 			"flow.origin_code",
@@ -203,28 +390,31 @@ func (dtd *DtdRepositorySql) findFlows(src, dst string, reversed bool) (flows []
 // FindFlowsForStations returns all flows between two NLC codes
 func (dtd *DtdRepositorySql) FindFlowsForStations(src, dst string) (flows []*models.FlowDetail, err error) {
 
-	logger.Infof("searching for all flows between src %v and dst %v", src, dst)
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("searching for all flows between src %v and dst %v", src, dst)
 
 	reversed := false
-	flows, err = dtd.findFlows(src, dst, reversed)
+	flows, err = findFlows(db, src, dst, reversed)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(flows) > 0 {
-		logger.Infof("returning %v flows between src %v and dst %v", len(flows), src, dst)
+		dtd.logger().Infof("returning %v flows between src %v and dst %v", len(flows), src, dst)
 		return flows, nil
 	}
 
-	logger.Warnf("found no flows for src %v and dst %v - searching flows in the reverse direction", src, dst)
+	dtd.logger().Warnf("found no flows for src %v and dst %v - searching flows in the reverse direction", src, dst)
 	reversed = true
-	flows, err = dtd.findFlows(dst, src, reversed)
+	flows, err = findFlows(db, dst, src, reversed)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(flows) > 0 {
-		logger.Infof("returning %v flows between src %v and dst %v", len(flows), src, dst)
+		dtd.logger().Infof("returning %v flows between src %v and dst %v", len(flows), src, dst)
 		return flows, nil
 	}
 
@@ -233,8 +423,11 @@ func (dtd *DtdRepositorySql) FindFlowsForStations(src, dst string) (flows []*mod
 
 func (dtd *DtdRepositorySql) FindAllFlowsForStation(nlc string) (flows []*models.FlowDetail, err error) {
 
-	logger.Infof("searching for all flows for nlc %v", nlc)
-	err = dtd.db.Unscoped().Model(&models.FlowData{}).
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("searching for all flows for nlc %v", nlc)
+	err = db.Unscoped().Model(&models.FlowData{}).
 		Select(
 			"flow.flow_id",
 			"flow.origin_code",
@@ -246,9 +439,9 @@ func (dtd *DtdRepositorySql) FindAllFlowsForStation(nlc string) (flows []*models
 			"route.description as route_desc",
 		).
 		Joins("LEFT JOIN route on flow.route_code = route.route_code").
-		Where(dtd.db.Where("origin_code = ?", nlc).Or("destination_code = ?", nlc)).
-		Where("start_date <= CURDATE()").
-		Where("end_date > CURDATE()").
+		Where(db.Where("flow.origin_code = ?", nlc).Or("flow.destination_code = ?", nlc)).
+		Where("flow.start_date <= CURDATE()").
+		Where("flow.end_date > CURDATE()").
 		Find(&flows).
 		Error
 
@@ -260,16 +453,19 @@ func (dtd *DtdRepositorySql) FindAllFlowsForStation(nlc string) (flows []*models
 		return nil, ErrNotFound
 	}
 
-	logger.Infof("returning %v flows for station nlc &v", len(flows), nlc)
+	dtd.logger().Infof("returning %v flows for station nlc %v", len(flows), nlc)
 
 	return flows, nil
 }
 
 func (dtd *DtdRepositorySql) FindFaresForFlows(flowIds []string) (fares []*models.FareDetail, err error) {
 
-	logger.Infof("finding fares for flowIDs %v", flowIds)
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("finding fares for flowIDs %v", flowIds)
 
-	err = dtd.db.Unscoped().Model(&models.FareData{}).
+	err = db.Unscoped().Model(&models.FareData{}).
 		Distinct(
 			"fare.id",
 			"fare.flow_id",
@@ -302,7 +498,39 @@ func (dtd *DtdRepositorySql) FindFaresForFlows(flowIds []string) (fares []*model
 		return nil, ErrNotFound
 	}
 
-	logger.Infof("returning %v fares for flowIDs &v", len(fares), flowIds)
+	dtd.logger().Infof("returning %v fares for flowIDs %v", len(fares), flowIds)
 
 	return fares, nil
 }
+
+// FindTicketTypes returns every current ticket type with its validity
+func (dtd *DtdRepositorySql) FindTicketTypes() (types []*models.TicketTypeData, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up ticket types")
+
+	err = db.Raw(ticket_types_query).Scan(&types).Error
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying for ticket types")
+	}
+
+	if len(types) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return types, nil
+}
+
+// FindTicketCatalogue returns the current ticket types indexed by ticket code
+func (dtd *DtdRepositorySql) FindTicketCatalogue() (models.TicketCatalogue, error) {
+
+	types, err := dtd.FindTicketTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewTicketCatalogue(types), nil
+}
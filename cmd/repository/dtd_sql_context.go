@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// WithContext returns a repository whose lookups run under ctx, so they can be cancelled and their
+// spans join its trace. Operations outside DtdRepository, such as imports, take ctx directly.
+func (dtd *DtdRepositorySql) WithContext(ctx context.Context) DtdRepository {
+	return dtd.bind(ctx)
+}
+
+func (dtd *DtdRepositorySql) bind(ctx context.Context) *DtdRepositorySql {
+	bound := *dtd
+	bound.db = dtd.db.WithContext(ctx)
+	return &bound
+}
+
+// query returns the database limited by the query timeout, under the context bound with WithContext,
+// along with a func that releases the timeout and classifies the lookup's error
+func (dtd *DtdRepositorySql) query() (*gorm.DB, func(error) error) {
+
+	ctx := dtd.db.Statement.Context
+	cancel := func() {}
+	if dtd.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, dtd.queryTimeout)
+	}
+
+	return dtd.db.WithContext(ctx), func(err error) error {
+		defer cancel()
+		return contextError(ctx, err)
+	}
+}
+
+// contextError makes ctx's error the cause of a failed lookup when ctx ending is what stopped it,
+// as the driver can report that as an invalid connection or an interrupted query
+func contextError(ctx context.Context, err error) error {
+
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	switch errors.Cause(err) {
+	case ctx.Err(), ErrNotFound:
+		return err
+	}
+
+	return errors.Wrap(ctx.Err(), err.Error())
+}
+
+// IsTimeout reports whether a lookup failed because its deadline or the query timeout passed
+func IsTimeout(err error) bool {
+	return errors.Cause(err) == context.DeadlineExceeded
+}
+
+// IsCanceled reports whether a lookup failed because its caller gave up on it
+func IsCanceled(err error) bool {
+	return errors.Cause(err) == context.Canceled
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDtdRepositorySql_queryTimeout(t *testing.T) {
+
+	db, mock := newMock()
+	dtd := &DtdRepositorySql{db: db, queryTimeout: 10 * time.Millisecond}
+
+	rows := sqlmock.NewRows([]string{"nlc", "source"}).AddRow("5598", "station")
+	mock.ExpectQuery(regexp.QuoteMeta(nlcs_query)).WithArgs("WAT", "WAT").WillDelayFor(time.Second).WillReturnRows(rows)
+
+	_, err := dtd.WithContext(context.Background()).FindNLCsRelatedToCrs("WAT")
+
+	assert.Error(t, err)
+	assert.True(t, IsTimeout(err), "expected a timeout, got %v", err)
+	assert.False(t, IsCanceled(err))
+}
+
+func TestDtdRepositorySql_WithContext_canceled(t *testing.T) {
+
+	db, mock := newMock()
+	dtd := &DtdRepositorySql{db: db}
+
+	rows := sqlmock.NewRows([]string{"nlc", "source"}).AddRow("5598", "station")
+	mock.ExpectQuery(regexp.QuoteMeta(nlcs_query)).WithArgs("WAT", "WAT").WillDelayFor(time.Second).WillReturnRows(rows)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := dtd.WithContext(ctx).FindNLCsRelatedToCrs("WAT")
+
+	assert.True(t, IsCanceled(err), "expected a cancellation, got %v", err)
+	assert.False(t, IsTimeout(err))
+}
+
+func Test_contextError(t *testing.T) {
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	driverErr := errors.New("invalid connection")
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		wantCause error
+	}{
+		{"should leave success alone", expired, nil, nil},
+		{"should leave errors alone while the context is live", context.Background(), driverErr, driverErr},
+		{"should keep not found after the deadline", expired, ErrNotFound, ErrNotFound},
+		{"should keep the context's own error", expired, errors.Wrap(context.DeadlineExceeded, "querying"), context.DeadlineExceeded},
+		{"should blame the deadline for driver errors", expired, driverErr, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contextError(tt.ctx, tt.err)
+			assert.Equal(t, tt.wantCause, errors.Cause(got))
+			if tt.err != nil {
+				assert.Contains(t, got.Error(), tt.err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/feed"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ErrDatasetActive is returned when an operation is not allowed on the active dataset
+var ErrDatasetActive = errors.New("dataset is active")
+
+// datasetTables are swapped together when a dataset is activated
+var datasetTables = []string{"location", "flow", "fare", "non_derivable_fare_override"}
+
+// datasetSuffix is appended to each of the datasetTables to name a dataset's own copy
+func datasetSuffix(id uint) string {
+	return fmt.Sprintf("_ds%d", id)
+}
+
+func (dtd *DtdRepositorySql) migrateDatasets() error {
+	if err := dtd.db.AutoMigrate(&models.DatasetData{}, &models.FeedSequenceData{}); err != nil {
+		return errors.Wrap(err, "migrating dataset tables")
+	}
+	return nil
+}
+
+// StageFeed loads a full refresh feed into a new set of tables without touching the live ones
+func (dtd *DtdRepositorySql) StageFeed(ctx context.Context, f *feed.Feed, name string) (ds *models.DatasetData, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	if !f.Full {
+		return nil, errors.Errorf("feed %03d is changes-only, only full refreshes can be staged", f.Sequence)
+	}
+
+	if err := dtd.migrateDatasets(); err != nil {
+		return nil, err
+	}
+
+	staged := &models.DatasetData{Name: name, Sequence: f.Sequence, Status: models.DatasetStaged}
+	if err := dtd.db.Create(staged).Error; err != nil {
+		return nil, errors.Wrap(err, "creating dataset")
+	}
+
+	// A dataset that failed to load is removed rather than left to be activated or cleaned up by hand.
+	// It's removed outside ctx as the load may have failed because ctx ended.
+	defer func() {
+		if err == nil {
+			return
+		}
+		if dropErr := dtd.bind(context.Background()).dropDataset(staged); dropErr != nil {
+			dtd.logger().Errorf("removing dataset %v after it failed to load: %v", staged.ID, dropErr)
+		}
+	}()
+
+	dtd.logger().Infof("staging feed %03d as dataset %v", f.Sequence, staged.ID)
+
+	suffix := datasetSuffix(staged.ID)
+	for _, table := range datasetTables {
+		err := dtd.db.Exec(fmt.Sprintf("CREATE TABLE %s%s LIKE %s", table, suffix, table)).Error
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating staging table for %s", table)
+		}
+	}
+
+	err = dtd.db.Transaction(func(tx *gorm.DB) error {
+		return dtd.applyFeedTables(tx, f, suffix)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading dataset %v", staged.ID)
+	}
+
+	return staged, nil
+}
+
+// FindDatasets returns every dataset that has not been dropped
+func (dtd *DtdRepositorySql) FindDatasets(ctx context.Context) (datasets []*models.DatasetData, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	if err := dtd.migrateDatasets(); err != nil {
+		return nil, err
+	}
+
+	err = dtd.db.Order("id ASC").Find(&datasets).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "querying datasets")
+	}
+
+	return datasets, nil
+}
+
+// ActivateDataset validates a dataset and atomically swaps its tables in as the live tables.
+// Integrity check failures only block activation when force is false.
+func (dtd *DtdRepositorySql) ActivateDataset(ctx context.Context, id uint, force bool) (err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	if err := dtd.prepareDatasets(); err != nil {
+		return err
+	}
+
+	next, err := dtd.findDataset(id)
+	if err != nil {
+		return err
+	}
+
+	if next.Status == models.DatasetActive {
+		return errors.Wrapf(ErrDatasetActive, "dataset %v", id)
+	}
+
+	if err := dtd.validateDataset(next, force); err != nil {
+		return err
+	}
+
+	current, err := dtd.activeDataset()
+	if err != nil {
+		return err
+	}
+
+	// Tables loaded before datasets existed get recorded so they can be rolled back to
+	if current == nil {
+		current = &models.DatasetData{Name: "initial", Sequence: -1, Status: models.DatasetActive}
+		if last, err := lastFeedSequence(dtd.db); err != nil {
+			return err
+		} else if last != nil {
+			current.Sequence = last.Sequence
+		}
+		if err := dtd.db.Create(current).Error; err != nil {
+			return errors.Wrap(err, "recording initial dataset")
+		}
+	}
+
+	// RENAME TABLE commits on its own so can't share a transaction with the datasets. The swap is
+	// recorded first so that if it's interrupted it can be finished or undone from the tables.
+	err = dtd.db.Model(next).Updates(map[string]interface{}{"status": models.DatasetActivating, "replaces_id": current.ID}).Error
+	if err != nil {
+		return errors.Wrap(err, "recording activation")
+	}
+
+	dtd.logger().Infof("swapping dataset %v out for dataset %v", current.ID, next.ID)
+
+	if err := dtd.db.Exec(renameStatement(current.ID, next.ID)).Error; err != nil {
+		// The rename may have gone through even though we didn't hear back
+		if resolveErr := dtd.bind(context.Background()).resolveActivation(current, next); resolveErr != nil {
+			dtd.logger().Errorf("resolving activation of dataset %v: %v", next.ID, resolveErr)
+		}
+		return errors.Wrap(err, "swapping dataset tables")
+	}
+
+	return dtd.finishActivation(current, next)
+}
+
+// prepareDatasets migrates the dataset tables and resolves any activation that was interrupted
+func (dtd *DtdRepositorySql) prepareDatasets() error {
+
+	if err := dtd.migrateDatasets(); err != nil {
+		return err
+	}
+
+	var activating []*models.DatasetData
+	if err := dtd.db.Where("status = ?", models.DatasetActivating).Find(&activating).Error; err != nil {
+		return errors.Wrap(err, "querying activating datasets")
+	}
+
+	for _, next := range activating {
+		if next.ReplacesID == nil {
+			return errors.Errorf("dataset %v is activating without the dataset it replaces", next.ID)
+		}
+		current, err := dtd.findDataset(*next.ReplacesID)
+		if err != nil {
+			return err
+		}
+		dtd.logger().Warnf("resolving interrupted activation of dataset %v", next.ID)
+		if err := dtd.resolveActivation(current, next); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveActivation finishes an activation if the tables were swapped, or undoes it if they weren't.
+// The rename is atomic so the replaced dataset's tables only exist under its suffix once it's done.
+func (dtd *DtdRepositorySql) resolveActivation(current, next *models.DatasetData) error {
+
+	swapped, err := dtd.tableExists(datasetTables[0] + datasetSuffix(current.ID))
+	if err != nil {
+		return err
+	}
+
+	if swapped {
+		return dtd.finishActivation(current, next)
+	}
+
+	err = dtd.db.Model(next).Updates(map[string]interface{}{"status": statusBeforeActivation(next), "replaces_id": nil}).Error
+	return errors.Wrapf(err, "undoing activation of dataset %v", next.ID)
+}
+
+// finishActivation records next as the active dataset once its tables have been swapped in
+func (dtd *DtdRepositorySql) finishActivation(current, next *models.DatasetData) error {
+
+	now := time.Now()
+	return dtd.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(current).Updates(map[string]interface{}{"status": models.DatasetInactive}).Error
+		if err != nil {
+			return errors.Wrap(err, "deactivating dataset")
+		}
+		err = tx.Model(next).Updates(map[string]interface{}{"status": models.DatasetActive, "activated_at": &now, "replaces_id": nil}).Error
+		if err != nil {
+			return errors.Wrap(err, "activating dataset")
+		}
+		// Changes-only feeds must now follow on from the activated round
+		return tx.Create(&models.FeedSequenceData{Sequence: next.Sequence, Full: true}).Error
+	})
+}
+
+// statusBeforeActivation is the status an activating dataset goes back to if its activation is undone
+func statusBeforeActivation(ds *models.DatasetData) string {
+	if ds.ActivatedAt != nil {
+		return models.DatasetInactive
+	}
+	return models.DatasetStaged
+}
+
+func (dtd *DtdRepositorySql) tableExists(table string) (bool, error) {
+	var count int64
+	err := dtd.db.Raw("SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).
+		Scan(&count).Error
+	return count > 0, errors.Wrapf(err, "checking for %s", table)
+}
+
+// RollbackDataset reactivates the dataset that was active before the current one
+func (dtd *DtdRepositorySql) RollbackDataset(ctx context.Context) (ds *models.DatasetData, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	if err := dtd.prepareDatasets(); err != nil {
+		return nil, err
+	}
+
+	var previous []*models.DatasetData
+	err = dtd.db.
+		Where("status = ?", models.DatasetInactive).
+		Order("updated_at DESC").
+		Limit(1).
+		Find(&previous).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "querying previous dataset")
+	}
+
+	if len(previous) == 0 {
+		return nil, errors.Wrap(ErrNotFound, "no previous dataset to roll back to")
+	}
+
+	// It has served queries before so integrity failures are not new
+	if err := dtd.ActivateDataset(ctx, previous[0].ID, true); err != nil {
+		return nil, err
+	}
+
+	return previous[0], nil
+}
+
+// DropDataset removes an inactive dataset along with its tables
+func (dtd *DtdRepositorySql) DropDataset(ctx context.Context, id uint) (err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	if err := dtd.prepareDatasets(); err != nil {
+		return err
+	}
+
+	ds, err := dtd.findDataset(id)
+	if err != nil {
+		return err
+	}
+
+	if ds.Status == models.DatasetActive {
+		return errors.Wrapf(ErrDatasetActive, "dataset %v cannot be dropped", id)
+	}
+
+	return dtd.dropDataset(ds)
+}
+
+// dropDataset removes a dataset's tables, skipping any it doesn't have, and then the dataset
+func (dtd *DtdRepositorySql) dropDataset(ds *models.DatasetData) error {
+
+	suffix := datasetSuffix(ds.ID)
+	for _, table := range datasetTables {
+		if err := dtd.db.Exec("DROP TABLE IF EXISTS " + table + suffix).Error; err != nil {
+			return errors.Wrapf(err, "dropping %s%s", table, suffix)
+		}
+	}
+
+	return errors.Wrapf(dtd.db.Delete(ds).Error, "deleting dataset %v", ds.ID)
+}
+
+func (dtd *DtdRepositorySql) findDataset(id uint) (*models.DatasetData, error) {
+
+	var datasets []*models.DatasetData
+	if err := dtd.db.Where("id = ?", id).Find(&datasets).Error; err != nil {
+		return nil, errors.Wrapf(err, "querying dataset %v", id)
+	}
+
+	if len(datasets) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "dataset %v", id)
+	}
+
+	return datasets[0], nil
+}
+
+func (dtd *DtdRepositorySql) activeDataset() (*models.DatasetData, error) {
+
+	var datasets []*models.DatasetData
+	if err := dtd.db.Where("status = ?", models.DatasetActive).Find(&datasets).Error; err != nil {
+		return nil, errors.Wrap(err, "querying active dataset")
+	}
+
+	if len(datasets) == 0 {
+		return nil, nil
+	}
+
+	return datasets[0], nil
+}
+
+// validateDataset makes sure none of the dataset's tables are empty and that it passes the integrity checks
+func (dtd *DtdRepositorySql) validateDataset(ds *models.DatasetData, force bool) error {
+
+	suffix := datasetSuffix(ds.ID)
+	for _, table := range datasetTables {
+		var count int64
+		if err := dtd.db.Table(table + suffix).Count(&count).Error; err != nil {
+			return errors.Wrapf(err, "counting rows in %s%s", table, suffix)
+		}
+		if count == 0 {
+			return errors.Errorf("dataset %v failed validation: %s%s is empty", ds.ID, table, suffix)
+		}
+	}
+
+	results, err := dtd.verifyIntegrity(suffix, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Passed() {
+			continue
+		}
+		if !force {
+			return errors.Errorf("dataset %v failed validation: %v %s", ds.ID, result.Violations, result.Description)
+		}
+		dtd.logger().Warnf("dataset %v has %v %s", ds.ID, result.Violations, result.Description)
+	}
+
+	return nil
+}
+
+// renameStatement swaps every dataset table in a single RENAME, which MySQL applies atomically
+func renameStatement(current, next uint) string {
+
+	renames := make([]string, 0, len(datasetTables)*2)
+	for _, table := range datasetTables {
+		renames = append(renames,
+			fmt.Sprintf("%s TO %s%s", table, table, datasetSuffix(current)),
+			fmt.Sprintf("%s%s TO %s", table, datasetSuffix(next), table),
+		)
+	}
+
+	return "RENAME TABLE " + strings.Join(renames, ", ")
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func Test_renameStatement(t *testing.T) {
+	want := "RENAME TABLE location TO location_ds1, location_ds2 TO location, " +
+		"flow TO flow_ds1, flow_ds2 TO flow, " +
+		"fare TO fare_ds1, fare_ds2 TO fare, " +
+		"non_derivable_fare_override TO non_derivable_fare_override_ds1, non_derivable_fare_override_ds2 TO non_derivable_fare_override"
+	assert.Equal(t, want, renameStatement(1, 2))
+}
+
+func Test_DtdRepositorySql_resolveActivation(t *testing.T) {
+
+	const tableExistsQuery = "SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+
+	activated := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		next       *models.DatasetData
+		swapped    bool
+		wantStatus string
+	}{
+		{
+			name:       "should finish the activation when the tables were swapped",
+			next:       &models.DatasetData{Model: gorm.Model{ID: 2}, Status: models.DatasetActivating, Sequence: 124},
+			swapped:    true,
+			wantStatus: models.DatasetActive,
+		},
+		{
+			name:       "should put a staged dataset back when the tables weren't swapped",
+			next:       &models.DatasetData{Model: gorm.Model{ID: 2}, Status: models.DatasetActivating},
+			wantStatus: models.DatasetStaged,
+		},
+		{
+			name:       "should put a rolled back dataset back when the tables weren't swapped",
+			next:       &models.DatasetData{Model: gorm.Model{ID: 2}, Status: models.DatasetActivating, ActivatedAt: &activated},
+			wantStatus: models.DatasetInactive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock()
+			dtd := &DtdRepositorySql{db: db}
+			current := &models.DatasetData{Model: gorm.Model{ID: 1}, Status: models.DatasetActive}
+
+			count := 0
+			if tt.swapped {
+				count = 1
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(tableExistsQuery)).
+				WithArgs("location_ds1").
+				WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(count))
+
+			mock.ExpectBegin()
+			if tt.swapped {
+				mock.ExpectExec("UPDATE `dataset` SET `status`=\\?").
+					WithArgs(models.DatasetInactive, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `dataset` SET `activated_at`=\\?,`replaces_id`=\\?,`status`=\\?").
+					WithArgs(sqlmock.AnyArg(), nil, models.DatasetActive, sqlmock.AnyArg(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `feed_sequence`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			} else {
+				mock.ExpectExec("UPDATE `dataset` SET `replaces_id`=\\?,`status`=\\?").
+					WithArgs(nil, tt.wantStatus, sqlmock.AnyArg(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			assert.NoError(t, dtd.resolveActivation(current, tt.next))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+)
+
+// FaresSnapshot picks a fares round to diff: the rows valid on Date in either the live tables,
+// or a dataset's tables when Dataset is set
+type FaresSnapshot struct {
+	Dataset uint
+	Date    time.Time
+}
+
+// snapshot is a FaresSnapshot resolved to the tables holding it
+type snapshot struct {
+	suffix string
+	date   time.Time
+}
+
+// diffSpec describes how to compare one kind of row. source selects the rows of a snapshot
+// with the key columns, any descriptive columns and a fare column if the rows have one.
+// Only versioned tables are staged per dataset, the rest are shared by every dataset.
+type diffSpec struct {
+	name      string
+	keys      []string
+	columns   []string
+	fare      string
+	versioned bool
+	source    func(s snapshot) (string, []interface{})
+}
+
+var diffSpecs = map[string]diffSpec{
+	"flow": {
+		name:      "flows",
+		keys:      []string{"origin_code", "destination_code", "route_code"},
+		columns:   []string{"toc", "direction"},
+		versioned: true,
+		source: func(s snapshot) (string, []interface{}) {
+			return `select origin_code, destination_code, route_code, max(toc) as toc, max(direction) as direction from flow` + s.suffix + `
+where start_date <= ? and end_date > ? group by origin_code, destination_code, route_code`, []interface{}{s.date, s.date}
+		},
+	},
+	"fare": {
+		name:      "fares",
+		keys:      []string{"origin_code", "destination_code", "route_code", "ticket_code", "restriction_code"},
+		columns:   []string{"toc"},
+		fare:      "fare",
+		versioned: true,
+		source: func(s snapshot) (string, []interface{}) {
+			return `select flow.origin_code, flow.destination_code, flow.route_code, fare.ticket_code, fare.restriction_code
+, max(flow.toc) as toc, min(fare.fare) as fare
+from flow` + s.suffix + ` flow inner join fare` + s.suffix + ` fare on flow.flow_id = fare.flow_id
+where flow.start_date <= ? and flow.end_date > ?
+group by flow.origin_code, flow.destination_code, flow.route_code, fare.ticket_code, fare.restriction_code`, []interface{}{s.date, s.date}
+		},
+	},
+	"ticket_type": {
+		name:    "ticket types",
+		keys:    []string{"ticket_code"},
+		columns: []string{"description"},
+		source: func(s snapshot) (string, []interface{}) {
+			return `select ticket_code, max(description) as description from ticket_type
+where start_date <= ? and end_date > ? group by ticket_code`, []interface{}{s.date, s.date}
+		},
+	},
+	"route": {
+		name:    "routes",
+		keys:    []string{"route_code"},
+		columns: []string{"description"},
+		source: func(s snapshot) (string, []interface{}) {
+			return `select route_code, max(description) as description from route
+where start_date <= ? and end_date > ? group by route_code`, []interface{}{s.date, s.date}
+		},
+	},
+	"ndfo": {
+		name:      "fare overrides",
+		keys:      []string{"origin_code", "destination_code", "route_code", "ticket_code", "restriction_code"},
+		fare:      "adult_fare",
+		versioned: true,
+		source: func(s snapshot) (string, []interface{}) {
+			return `select origin_code, destination_code, route_code, ticket_code, restriction_code, min(adult_fare) as adult_fare
+from non_derivable_fare_override` + s.suffix + `
+where start_date <= ? and end_date > ? and railcard_code = ''
+group by origin_code, destination_code, route_code, ticket_code, restriction_code`, []interface{}{s.date, s.date}
+		},
+	},
+}
+
+// diffStatement builds a single query returning the rows added to, removed from and, when the spec
+// has a fare or descriptive columns, changed between the before and after snapshots
+func diffStatement(spec diffSpec, before, after snapshot) (string, []interface{}) {
+
+	oldSQL, oldArgs := spec.source(before)
+	newSQL, newArgs := spec.source(after)
+
+	on := make([]string, len(spec.keys))
+	for i, k := range spec.keys {
+		on[i] = "o." + k + " = n." + k
+	}
+	join := strings.Join(on, " and ")
+
+	selectFrom := func(alias string) string {
+		cols := make([]string, 0, len(spec.keys)+len(spec.columns))
+		for _, c := range append(append([]string{}, spec.keys...), spec.columns...) {
+			cols = append(cols, alias+"."+c)
+		}
+		return strings.Join(cols, ", ")
+	}
+
+	fare := func(alias string) string {
+		if spec.fare == "" {
+			return "0"
+		}
+		return alias + "." + spec.fare
+	}
+
+	added := "select '" + models.DiffAdded + "' as change_type, " + selectFrom("n") +
+		", 0 as old_fare, " + fare("n") + " as new_fare" +
+		" from (" + newSQL + ") n left join (" + oldSQL + ") o on " + join +
+		" where o." + spec.keys[0] + " is null"
+	args := append(append([]interface{}{}, newArgs...), oldArgs...)
+
+	removed := "select '" + models.DiffRemoved + "' as change_type, " + selectFrom("o") +
+		", " + fare("o") + " as old_fare, 0 as new_fare" +
+		" from (" + oldSQL + ") o left join (" + newSQL + ") n on " + join +
+		" where n." + spec.keys[0] + " is null"
+	args = append(append(args, oldArgs...), newArgs...)
+
+	statement := added + "\nunion all\n" + removed
+
+	// Descriptive columns can be null so are compared null-safe
+	var differs []string
+	for _, c := range spec.columns {
+		differs = append(differs, "not o."+c+" <=> n."+c)
+	}
+	if spec.fare != "" {
+		differs = append(differs, fare("o")+" <> "+fare("n"))
+	}
+
+	if len(differs) > 0 {
+		changed := "select '" + models.DiffChanged + "' as change_type, " + selectFrom("n") +
+			", " + fare("o") + " as old_fare, " + fare("n") + " as new_fare" +
+			" from (" + oldSQL + ") o inner join (" + newSQL + ") n on " + join +
+			" where " + strings.Join(differs, " or ")
+		statement += "\nunion all\n" + changed
+		args = append(append(args, oldArgs...), newArgs...)
+	}
+
+	return statement, args
+}
+
+// resolveSnapshot finds which tables hold a snapshot's dataset
+func (dtd *DtdRepositorySql) resolveSnapshot(s FaresSnapshot) (snapshot, error) {
+
+	resolved := snapshot{date: s.Date}
+	if s.Dataset == 0 {
+		return resolved, nil
+	}
+
+	if err := dtd.migrateDatasets(); err != nil {
+		return resolved, err
+	}
+
+	ds, err := dtd.findDataset(s.Dataset)
+	if err != nil {
+		return resolved, err
+	}
+
+	// The active dataset's tables have been renamed to the live tables
+	if ds.Status != models.DatasetActive {
+		resolved.suffix = datasetSuffix(ds.ID)
+	}
+
+	return resolved, nil
+}
+
+// DiffFares compares two fares rounds
+func (dtd *DtdRepositorySql) DiffFares(ctx context.Context, from, to FaresSnapshot) (diff *models.FaresDiff, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	before, err := dtd.resolveSnapshot(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving old snapshot")
+	}
+
+	after, err := dtd.resolveSnapshot(to)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving new snapshot")
+	}
+
+	diff = &models.FaresDiff{}
+	targets := []struct {
+		spec string
+		rows *[]*models.FaresDiffRow
+	}{
+		{"flow", &diff.Flows},
+		{"fare", &diff.Fares},
+		{"ticket_type", &diff.TicketTypes},
+		{"route", &diff.Routes},
+		{"ndfo", &diff.Overrides},
+	}
+
+	for _, t := range targets {
+		spec := diffSpecs[t.spec]
+
+		// Comparing the shared tables between datasets would only show what changed between the dates
+		if !spec.versioned && before.suffix != after.suffix {
+			dtd.logger().Infof("not diffing %s, they aren't kept per dataset", spec.name)
+			diff.Unversioned = append(diff.Unversioned, spec.name)
+			continue
+		}
+
+		dtd.logger().Infof("diffing %s", spec.name)
+
+		statement, args := diffStatement(spec, before, after)
+		if err := dtd.db.Raw(statement, args...).Scan(t.rows).Error; err != nil {
+			return nil, errors.Wrapf(err, "diffing %s", spec.name)
+		}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diffStatement(t *testing.T) {
+
+	before := snapshot{suffix: "_ds1", date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)}
+	after := snapshot{date: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("should report renamed routes as changed", func(t *testing.T) {
+		statement, args := diffStatement(diffSpecs["route"], before, after)
+
+		assert.Equal(t, 2, strings.Count(statement, "union all"))
+		assert.Contains(t, statement, "select 'added' as change_type, n.route_code, n.description, 0 as old_fare, 0 as new_fare")
+		assert.Contains(t, statement, "on o.route_code = n.route_code where o.route_code is null")
+		assert.Contains(t, statement, "select 'changed' as change_type, n.route_code, n.description, 0 as old_fare, 0 as new_fare")
+		assert.Contains(t, statement, "where not o.description <=> n.description")
+		assert.Equal(t, []interface{}{after.date, after.date, before.date, before.date, before.date, before.date, after.date, after.date, before.date, before.date, after.date, after.date}, args)
+	})
+
+	t.Run("should report flows changing toc or direction as changed", func(t *testing.T) {
+		statement, _ := diffStatement(diffSpecs["flow"], before, after)
+
+		assert.Contains(t, statement, "from flow_ds1")
+		assert.Contains(t, statement, "where not o.toc <=> n.toc or not o.direction <=> n.direction")
+	})
+
+	t.Run("should compare fares between dataset tables", func(t *testing.T) {
+		statement, args := diffStatement(diffSpecs["fare"], before, after)
+
+		assert.Equal(t, 2, strings.Count(statement, "union all"))
+		assert.Contains(t, statement, "from flow_ds1 flow inner join fare_ds1 fare")
+		assert.Contains(t, statement, "from flow flow inner join fare fare")
+		assert.Contains(t, statement, "select 'changed' as change_type, n.origin_code, n.destination_code, n.route_code, n.ticket_code, n.restriction_code, n.toc, o.fare as old_fare, n.fare as new_fare")
+		assert.Contains(t, statement, "where not o.toc <=> n.toc or o.fare <> n.fare")
+		assert.Len(t, args, 12)
+		assert.Equal(t, before.date, args[len(args)-4])
+		assert.Equal(t, after.date, args[len(args)-1])
+	})
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jdheyburn/stc/cmd/geo"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ImportStationGeo replaces every station's coordinates in a single transaction
+func (dtd *DtdRepositorySql) ImportStationGeo(ctx context.Context, stations []*models.StationGeoData) (err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	dtd.logger().Infof("importing coordinates for %v stations", len(stations))
+
+	if err := dtd.db.AutoMigrate(&models.StationGeoData{}); err != nil {
+		return errors.Wrap(err, "migrating station geo table")
+	}
+
+	return dtd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.StationGeoData{}).Error; err != nil {
+			return errors.Wrap(err, "clearing station geo table")
+		}
+		if len(stations) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(stations, importBatchSize).Error; err != nil {
+			return errors.Wrap(err, "inserting station coordinates")
+		}
+		return nil
+	})
+}
+
+// FindStationGeo returns the coordinates of a station
+func (dtd *DtdRepositorySql) FindStationGeo(crs string) (station *models.StationGeoData, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up coordinates for crs %v", crs)
+
+	var stations []*models.StationGeoData
+	err = db.Where("crs = ?", crs).Find(&stations).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying coordinates for crs %s", crs)
+	}
+
+	if len(stations) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return stations[0], nil
+}
+
+// FindStationsNear returns up to limit stations within radiusKm of a point, nearest first
+func (dtd *DtdRepositorySql) FindStationsNear(p geo.Point, radiusKm float64, limit int) (near []*models.StationGeoDetail, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("searching for stations within %vkm of %v,%v", radiusKm, p.Lat, p.Lon)
+
+	min, max := geo.BoundingBox(p, radiusKm)
+
+	var stations []*models.StationGeoDetail
+	err = db.Model(&models.StationGeoData{}).
+		Select(
+			"station_geo.crs",
+			"location.nlc",
+			"location.description",
+			"station_geo.latitude",
+			"station_geo.longitude",
+		).
+		Joins("INNER JOIN location on station_geo.crs = location.crs AND location.start_date <= CURDATE() AND location.end_date > CURDATE()").
+		Where("station_geo.latitude BETWEEN ? AND ?", min.Lat, max.Lat).
+		Where("station_geo.longitude BETWEEN ? AND ?", min.Lon, max.Lon).
+		Find(&stations).
+		Error
+
+	if err != nil {
+		return nil, errors.Wrap(err, "querying for nearby stations")
+	}
+
+	// The bounding box includes its corners, which are further away than the radius
+	for _, s := range stations {
+		s.DistanceKm = geo.Distance(p, s.Point())
+		s.Miles = geo.Miles(s.DistanceKm)
+		if s.DistanceKm <= radiusKm {
+			near = append(near, s)
+		}
+	}
+
+	sort.Slice(near, func(i, j int) bool {
+		return near[i].DistanceKm < near[j].DistanceKm
+	})
+
+	if limit > 0 && len(near) > limit {
+		near = near[:limit]
+	}
+
+	return near, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jdheyburn/stc/cmd/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+const findStationsNearQuery = "SELECT station_geo.crs,location.nlc,location.description,station_geo.latitude,station_geo.longitude FROM `station_geo` INNER JOIN location on station_geo.crs = location.crs AND location.start_date <= CURDATE() AND location.end_date > CURDATE() WHERE (station_geo.latitude BETWEEN ? AND ?) AND (station_geo.longitude BETWEEN ? AND ?)"
+
+func TestDtdRepositorySql_FindStationsNear(t *testing.T) {
+
+	db, mock := newMock()
+	dtd := &DtdRepositorySql{db: db}
+
+	rows := sqlmock.NewRows([]string{"crs", "nlc", "description", "latitude", "longitude"}).
+		AddRow("WOK", "5598", "WOKING", 51.318478, -0.557022).
+		AddRow("VXH", "5588", "VAUXHALL", 51.486180, -0.122924).
+		AddRow("WAT", "5598", "LONDON WATERLOO", 51.503106, -0.113184).
+		AddRow("GLD", "5565", "GUILDFORD", 51.236968, -0.580410)
+
+	mock.ExpectQuery(regexp.QuoteMeta(findStationsNearQuery)).WillReturnRows(rows)
+
+	got, err := dtd.FindStationsNear(geo.Point{Lat: 51.5031, Lon: -0.1132}, 40, 0)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var crs []string
+	for _, s := range got {
+		crs = append(crs, s.CRS)
+	}
+	// Guildford is inside the bounding box corner but beyond the radius
+	assert.Equal(t, []string{"WAT", "VXH", "WOK"}, crs)
+	assert.InDelta(t, 0, got[0].DistanceKm, 0.01)
+}
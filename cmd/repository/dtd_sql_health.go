@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+)
+
+// DB returns the connection pool underneath the repository
+func (dtd *DtdRepositorySql) DB() (*sql.DB, error) {
+	return dtd.db.DB()
+}
+
+// Ping checks the database can be reached
+func (dtd *DtdRepositorySql) Ping(ctx context.Context) error {
+	db, err := dtd.db.DB()
+	if err != nil {
+		return errors.Wrap(err, "getting sql conn")
+	}
+	return contextError(ctx, errors.Wrap(db.PingContext(ctx), "pinging database"))
+}
+
+// FaresStatus counts the current flows and finds the last feed applied, if feeds have been tracked
+func (dtd *DtdRepositorySql) FaresStatus(ctx context.Context) (status *models.FaresStatus, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	status = &models.FaresStatus{}
+
+	err = dtd.db.Unscoped().Model(&models.FlowData{}).
+		Where("start_date <= CURDATE()").
+		Where("end_date > CURDATE()").
+		Count(&status.CurrentFlows).
+		Error
+	if err != nil {
+		return nil, errors.Wrap(err, "counting current flows")
+	}
+
+	if !dtd.db.Migrator().HasTable(&models.FeedSequenceData{}) {
+		return status, nil
+	}
+
+	if status.LastFeed, err = lastFeedSequence(dtd.db); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
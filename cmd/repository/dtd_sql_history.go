@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ArchiveFares copies the fares and fare overrides valid on the effective date into the history table
+// as a named round, replacing any round already archived for that date
+func (dtd *DtdRepositorySql) ArchiveFares(ctx context.Context, round string, effective time.Time) (archived int64, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	dtd.logger().Infof("archiving fares round %v effective %v", round, effective.Format("2006-01-02"))
+
+	if err := dtd.db.AutoMigrate(&models.FareHistoryData{}); err != nil {
+		return 0, errors.Wrap(err, "migrating fare history table")
+	}
+
+	effective = time.Date(effective.Year(), effective.Month(), effective.Day(), 0, 0, 0, 0, time.UTC)
+
+	err = dtd.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("effective_from = ?", effective).Delete(&models.FareHistoryData{}).Error; err != nil {
+			return errors.Wrap(err, "clearing archived round")
+		}
+
+		for _, archive := range []struct {
+			name  string
+			query string
+		}{
+			{"fares", archive_fares_query},
+			{"fare overrides", archive_fare_overrides_query},
+		} {
+			result := tx.Exec(archive.query, round, effective, effective, effective)
+			if result.Error != nil {
+				return errors.Wrapf(result.Error, "archiving %s", archive.name)
+			}
+			archived += result.RowsAffected
+		}
+
+		return nil
+	})
+
+	return archived, err
+}
+
+// FindFareHistory returns every archived fare between two sets of NLCs, in either direction for
+// reversible flows, optionally limited to some ticket codes and to rounds effective from since
+// up to until. A zero since or until leaves that end open.
+func (dtd *DtdRepositorySql) FindFareHistory(srcNlcs, dstNlcs, ticketCodes []string, since, until time.Time) (history []*models.FareHistoryData, err error) {
+
+	db, done := dtd.query()
+	defer func() { err = done(err) }()
+
+	dtd.logger().Infof("looking up fare history related to nlcs")
+
+	query := db.
+		Where(db.
+			Where("origin_code IN ? AND destination_code IN ?", srcNlcs, dstNlcs).
+			Or("origin_code IN ? AND destination_code IN ? AND direction = 'R'", dstNlcs, srcNlcs))
+
+	if len(ticketCodes) > 0 {
+		query = query.Where("ticket_code IN ?", ticketCodes)
+	}
+
+	if !since.IsZero() {
+		query = query.Where("effective_from >= ?", since)
+	}
+
+	if !until.IsZero() {
+		query = query.Where("effective_from <= ?", until)
+	}
+
+	err = query.Order("effective_from ASC").Order("fare ASC").Find(&history).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "querying fare history")
+	}
+
+	return history, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDtdRepositorySql_FindFareHistory(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		ticketCodes []string
+		since       time.Time
+		until       time.Time
+		query       string
+		args        []driver.Value
+	}{
+		{
+			name:  "should find history in both directions",
+			query: "SELECT * FROM `fare_history` WHERE ((origin_code IN (?) AND destination_code IN (?)) OR (origin_code IN (?) AND destination_code IN (?) AND direction = 'R')) ORDER BY effective_from ASC,fare ASC",
+			args:  []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()},
+		},
+		{
+			name:        "should filter on ticket codes",
+			ticketCodes: []string{"7DS", "SDR"},
+			query:       "SELECT * FROM `fare_history` WHERE ((origin_code IN (?) AND destination_code IN (?)) OR (origin_code IN (?) AND destination_code IN (?) AND direction = 'R')) AND ticket_code IN (?,?) ORDER BY effective_from ASC,fare ASC",
+			args:        []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "7DS", "SDR"},
+		},
+		{
+			name:  "should filter on effective dates",
+			since: *newDateField(2020, 1, 1),
+			until: *newDateField(2021, 12, 31),
+			query: "SELECT * FROM `fare_history` WHERE ((origin_code IN (?) AND destination_code IN (?)) OR (origin_code IN (?) AND destination_code IN (?) AND direction = 'R')) AND effective_from >= ? AND effective_from <= ? ORDER BY effective_from ASC,fare ASC",
+			args:  []driver.Value{sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), *newDateField(2020, 1, 1), *newDateField(2021, 12, 31)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock()
+			dtd := &DtdRepositorySql{db: db}
+
+			rows := sqlmock.NewRows([]string{"id", "round", "effective_from", "origin_code", "destination_code", "ticket_code", "fare"}).
+				AddRow(1, "2021", newDateField(2021, 3, 1), "5598", "1072", "7DS", 5200)
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WithArgs(tt.args...).WillReturnRows(rows)
+
+			got, err := dtd.FindFareHistory([]string{"5598"}, []string{"1072"}, tt.ticketCodes, tt.since, tt.until)
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.Len(t, got, 1)
+			assert.Equal(t, uint(5200), got[0].Fare)
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jdheyburn/stc/cmd/feed"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ErrOutOfSequence is returned when a feed is not the next one expected by the database
+var ErrOutOfSequence = errors.New("feed out of sequence")
+
+// feedSequenceWrap is where the three digit feed sequence number rolls over
+const feedSequenceWrap = 1000
+
+const importBatchSize = 500
+
+// feedRow is a single record converted into the columns of its table
+type feedRow struct {
+	marker feed.UpdateMarker
+	key    map[string]interface{}
+	values map[string]interface{}
+}
+
+// ApplyFeed applies a full refresh or changes-only feed in a single transaction
+func (dtd *DtdRepositorySql) ApplyFeed(ctx context.Context, f *feed.Feed) (err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+
+	dtd.logger().Infof("applying feed %03d (full refresh: %v)", f.Sequence, f.Full)
+
+	if err := dtd.db.AutoMigrate(&models.FeedSequenceData{}); err != nil {
+		return errors.Wrap(err, "migrating feed sequence table")
+	}
+
+	return dtd.db.Transaction(func(tx *gorm.DB) error {
+
+		if err := checkNextFeed(tx, f); err != nil {
+			return err
+		}
+
+		if err := dtd.applyFeedTables(tx, f, ""); err != nil {
+			return err
+		}
+
+		applied := &models.FeedSequenceData{Sequence: f.Sequence, Full: f.Full}
+		if err := tx.Create(applied).Error; err != nil {
+			return errors.Wrap(err, "recording feed sequence")
+		}
+
+		return nil
+	})
+}
+
+// LastFeedSequence returns the most recently applied feed, or ErrNotFound if none has been applied
+func (dtd *DtdRepositorySql) LastFeedSequence() (*models.FeedSequenceData, error) {
+
+	last, err := lastFeedSequence(dtd.db)
+	if err != nil {
+		return nil, err
+	}
+
+	if last == nil {
+		return nil, ErrNotFound
+	}
+
+	return last, nil
+}
+
+func lastFeedSequence(db *gorm.DB) (*models.FeedSequenceData, error) {
+
+	var seqs []*models.FeedSequenceData
+
+	err := db.Order("id DESC").Limit(1).Find(&seqs).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "querying last feed sequence")
+	}
+
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+
+	return seqs[0], nil
+}
+
+// checkNextFeed checks the feed can be applied after the last one recorded in the database
+func checkNextFeed(db *gorm.DB, f *feed.Feed) error {
+
+	last, err := lastFeedSequence(db)
+	if err != nil {
+		return err
+	}
+
+	return checkFeedSequence(last, f)
+}
+
+// checkFeedSequence refuses changes-only feeds that do not directly follow the last applied feed,
+// and full refreshes older than it
+func checkFeedSequence(last *models.FeedSequenceData, f *feed.Feed) error {
+
+	if last == nil {
+		if !f.Full {
+			return errors.Wrapf(ErrOutOfSequence, "changes-only feed %03d cannot be applied before a full refresh", f.Sequence)
+		}
+		return nil
+	}
+
+	if f.Full {
+		if f.Sequence == last.Sequence {
+			return errors.Wrapf(ErrOutOfSequence, "feed %03d has already been applied", f.Sequence)
+		}
+		// Sequences wrap, so a refresh is newer when it is less than half the wrap ahead
+		if ahead := (f.Sequence - last.Sequence + feedSequenceWrap) % feedSequenceWrap; ahead >= feedSequenceWrap/2 {
+			return errors.Wrapf(ErrOutOfSequence, "full refresh %03d is older than the last applied feed %03d", f.Sequence, last.Sequence)
+		}
+		return nil
+	}
+
+	expected := (last.Sequence + 1) % feedSequenceWrap
+	if f.Sequence != expected {
+		return errors.Wrapf(ErrOutOfSequence, "expected feed %03d but got %03d", expected, f.Sequence)
+	}
+
+	return nil
+}
+
+// applyFeedTables writes each record type to its table, with suffix selecting a staged dataset
+func (dtd *DtdRepositorySql) applyFeedTables(tx *gorm.DB, f *feed.Feed, suffix string) error {
+
+	tables := []struct {
+		name string
+		rows []*feedRow
+	}{
+		{"location", locationRows(f.Locations)},
+		{"flow", flowRows(f.Flows)},
+		{"fare", fareRows(f.Fares)},
+		{"non_derivable_fare_override", fareOverrideRows(f.Overrides)},
+	}
+
+	for _, t := range tables {
+		if len(t.rows) == 0 {
+			continue
+		}
+		if err := applyRows(tx, t.name+suffix, t.rows, f.Full); err != nil {
+			return errors.Wrapf(err, "applying %s records", t.name)
+		}
+		dtd.logger().Infof("applied %v %s records", len(t.rows), t.name+suffix)
+	}
+
+	return nil
+}
+
+func applyRows(tx *gorm.DB, table string, rows []*feedRow, full bool) error {
+
+	if full {
+		if err := tx.Exec("DELETE FROM " + table).Error; err != nil {
+			return errors.Wrapf(err, "clearing %s", table)
+		}
+
+		var batch []map[string]interface{}
+		for _, row := range rows {
+			batch = append(batch, row.columns())
+			if len(batch) == importBatchSize {
+				if err := tx.Table(table).Create(batch).Error; err != nil {
+					return err
+				}
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			return tx.Table(table).Create(batch).Error
+		}
+		return nil
+	}
+
+	for _, row := range rows {
+		clause, args := row.where()
+
+		switch row.marker {
+		case feed.Insert:
+			if err := tx.Table(table).Create(row.columns()).Error; err != nil {
+				return errors.Wrapf(err, "inserting %v", row.key)
+			}
+		case feed.Amend:
+			res := tx.Table(table).Where(clause, args...).Updates(row.values)
+			if res.Error != nil {
+				return errors.Wrapf(res.Error, "amending %v", row.key)
+			}
+			if res.RowsAffected == 0 {
+				return errors.Wrapf(ErrNotFound, "amending %v", row.key)
+			}
+		case feed.Delete:
+			res := tx.Exec("DELETE FROM "+table+" WHERE "+clause, args...)
+			if res.Error != nil {
+				return errors.Wrapf(res.Error, "deleting %v", row.key)
+			}
+			if res.RowsAffected == 0 {
+				return errors.Wrapf(ErrNotFound, "deleting %v", row.key)
+			}
+		default:
+			return errors.Errorf("unexpected update marker %q in changes-only feed", row.marker)
+		}
+	}
+
+	return nil
+}
+
+// columns merges the key and value columns for inserts
+func (r *feedRow) columns() map[string]interface{} {
+	cols := make(map[string]interface{}, len(r.key)+len(r.values))
+	for k, v := range r.key {
+		cols[k] = v
+	}
+	for k, v := range r.values {
+		cols[k] = v
+	}
+	return cols
+}
+
+// where builds a deterministic clause matching the record key
+func (r *feedRow) where() (string, []interface{}) {
+
+	cols := make([]string, 0, len(r.key))
+	for k := range r.key {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+
+	conds := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, c := range cols {
+		conds[i] = c + " = ?"
+		args[i] = r.key[c]
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+func flowRows(records []*feed.FlowRecord) (rows []*feedRow) {
+	for _, r := range records {
+		rows = append(rows, &feedRow{
+			marker: r.Marker,
+			key: map[string]interface{}{
+				"origin_code":      r.OriginCode,
+				"destination_code": r.DestinationCode,
+				"route_code":       r.RouteCode,
+				"status_code":      r.StatusCode,
+				"usage_code":       r.UsageCode,
+				"direction":        r.Direction,
+				"end_date":         r.EndDate,
+			},
+			values: map[string]interface{}{
+				"flow_id":          r.FlowID,
+				"start_date":       r.StartDate,
+				"toc":              r.TOC,
+				"cross_london_ind": r.CrossLondonInd,
+				"ns_disc_ind":      r.NsDiscInd,
+				"publication_ind":  r.PublicationInd,
+			},
+		})
+	}
+	return rows
+}
+
+func fareRows(records []*feed.FareRecord) (rows []*feedRow) {
+	for _, r := range records {
+		rows = append(rows, &feedRow{
+			marker: r.Marker,
+			key: map[string]interface{}{
+				"flow_id":     r.FlowID,
+				"ticket_code": r.TicketCode,
+			},
+			values: map[string]interface{}{
+				"fare":             r.Fare,
+				"restriction_code": r.RestrictionCode,
+			},
+		})
+	}
+	return rows
+}
+
+func locationRows(records []*feed.LocationRecord) (rows []*feedRow) {
+	for _, r := range records {
+		row := &feedRow{
+			marker: r.Marker,
+			key: map[string]interface{}{
+				"uic":      r.UIC,
+				"end_date": r.EndDate,
+			},
+			values: map[string]interface{}{
+				"start_date":      r.StartDate,
+				"quote_date":      r.QuoteDate,
+				"admin_area_code": r.AdminAreaCode,
+				"nlc":             r.NLC,
+				"description":     r.Description,
+				"crs":             r.CRS,
+				"resv_code":       r.ResvCode,
+				"ers_country":     r.ERSCountry,
+				"ers_code":        r.ERSCode,
+				"fare_group":      r.FareGroup,
+				"county":          r.County,
+				"pte_code":        r.PTECode,
+				"zone_no":         r.ZoneNo,
+				"zone_ind":        r.ZoneInd,
+				"region":          r.Region,
+				"hierarchy":       r.Hierarchy,
+			},
+		}
+		for i, zone := range r.LULZones {
+			row.values[fmt.Sprintf("lul_zone_%d", i+1)] = zone
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func fareOverrideRows(records []*feed.FareOverrideRecord) (rows []*feedRow) {
+	for _, r := range records {
+		rows = append(rows, &feedRow{
+			marker: r.Marker,
+			key: map[string]interface{}{
+				"origin_code":      r.OriginCode,
+				"destination_code": r.DestinationCode,
+				"route_code":       r.RouteCode,
+				"railcard_code":    r.RailcardCode,
+				"ticket_code":      r.TicketCode,
+				"nd_record_type":   r.NdRecordType,
+				"end_date":         r.EndDate,
+			},
+			values: map[string]interface{}{
+				"start_date":          r.StartDate,
+				"quote_date":          r.QuoteDate,
+				"suppress_mkr":        r.SuppressMkr,
+				"adult_fare":          r.AdultFare,
+				"child_fare":          r.ChildFare,
+				"restriction_code":    r.RestrictionCode,
+				"composite_indicator": r.CompositeIndicator,
+				"cross_london_ind":    r.CrossLondonInd,
+				"ps_ind":              r.PsInd,
+			},
+		})
+	}
+	return rows
+}
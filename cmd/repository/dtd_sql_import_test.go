@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jdheyburn/stc/cmd/feed"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func Test_checkFeedSequence(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		last    *models.FeedSequenceData
+		feed    *feed.Feed
+		wantErr bool
+	}{
+		{
+			name: "should accept a full refresh into an empty database",
+			feed: &feed.Feed{Sequence: 123, Full: true},
+		},
+		{
+			name:    "should refuse changes-only feed into an empty database",
+			feed:    &feed.Feed{Sequence: 123},
+			wantErr: true,
+		},
+		{
+			name: "should accept the next changes-only feed",
+			last: &models.FeedSequenceData{Sequence: 123, Full: true},
+			feed: &feed.Feed{Sequence: 124},
+		},
+		{
+			name: "should accept the next changes-only feed across the sequence wrap",
+			last: &models.FeedSequenceData{Sequence: 999},
+			feed: &feed.Feed{Sequence: 0},
+		},
+		{
+			name:    "should refuse a skipped changes-only feed",
+			last:    &models.FeedSequenceData{Sequence: 123},
+			feed:    &feed.Feed{Sequence: 125},
+			wantErr: true,
+		},
+		{
+			name:    "should refuse reapplying a changes-only feed",
+			last:    &models.FeedSequenceData{Sequence: 123},
+			feed:    &feed.Feed{Sequence: 123},
+			wantErr: true,
+		},
+		{
+			name:    "should refuse reapplying a full refresh",
+			last:    &models.FeedSequenceData{Sequence: 123, Full: true},
+			feed:    &feed.Feed{Sequence: 123, Full: true},
+			wantErr: true,
+		},
+		{
+			name: "should accept a newer full refresh",
+			last: &models.FeedSequenceData{Sequence: 123},
+			feed: &feed.Feed{Sequence: 130, Full: true},
+		},
+		{
+			name: "should accept a newer full refresh across the sequence wrap",
+			last: &models.FeedSequenceData{Sequence: 998},
+			feed: &feed.Feed{Sequence: 2, Full: true},
+		},
+		{
+			name:    "should refuse an older full refresh",
+			last:    &models.FeedSequenceData{Sequence: 123},
+			feed:    &feed.Feed{Sequence: 120, Full: true},
+			wantErr: true,
+		},
+		{
+			name:    "should refuse an older full refresh across the sequence wrap",
+			last:    &models.FeedSequenceData{Sequence: 2},
+			feed:    &feed.Feed{Sequence: 998, Full: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFeedSequence(tt.last, tt.feed)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_checkNextFeed(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		feed    *feed.Feed
+		wantErr error
+	}{
+		{"should accept a newer full refresh", &feed.Feed{Sequence: 201, Full: true}, nil},
+		{"should refuse an older full refresh", &feed.Feed{Sequence: 150, Full: true}, ErrOutOfSequence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock()
+
+			rows := sqlmock.NewRows([]string{"id", "sequence", "full"}).AddRow(7, 200, false)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `feed_sequence`")).WillReturnRows(rows)
+
+			err := checkNextFeed(db, tt.feed)
+			assert.Equal(t, tt.wantErr, errors.Cause(err))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_applyRows_changesOnly(t *testing.T) {
+
+	const (
+		amendQuery  = "UPDATE `flow` SET `end_date`=? WHERE flow_id = ?"
+		deleteQuery = "DELETE FROM flow WHERE flow_id = ?"
+	)
+
+	amend := &feedRow{marker: feed.Amend, key: map[string]interface{}{"flow_id": 1}, values: map[string]interface{}{"end_date": "2021-01-01"}}
+	del := &feedRow{marker: feed.Delete, key: map[string]interface{}{"flow_id": 1}}
+
+	tests := []struct {
+		name    string
+		row     *feedRow
+		query   string
+		args    []driver.Value
+		matched int64
+		wantErr error
+	}{
+		{
+			// The DSN sets clientFoundRows, so MySQL reports the row as matched even when it is unchanged
+			name:    "should amend an existing record",
+			row:     amend,
+			query:   amendQuery,
+			args:    []driver.Value{"2021-01-01", 1},
+			matched: 1,
+		},
+		{
+			name:    "should refuse amending a missing record",
+			row:     amend,
+			query:   amendQuery,
+			args:    []driver.Value{"2021-01-01", 1},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "should delete an existing record",
+			row:     del,
+			query:   deleteQuery,
+			args:    []driver.Value{1},
+			matched: 1,
+		},
+		{
+			name:    "should refuse deleting a missing record",
+			row:     del,
+			query:   deleteQuery,
+			args:    []driver.Value{1},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(tt.query)).
+				WithArgs(tt.args...).
+				WillReturnResult(sqlmock.NewResult(0, tt.matched))
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return applyRows(tx, "flow", []*feedRow{tt.row}, false)
+			})
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, errors.Cause(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
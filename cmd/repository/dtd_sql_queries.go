@@ -13,27 +13,28 @@ this_group_members_loc as (
 ),
 nlcs as (
 	-- query 1 - this location NLC
-	Select nlc from this_loc
+	Select nlc, 'station' as source, 1 as priority from this_loc
 	union
 	-- query 2 - clustered location NLC
-	select cluster_id as nlc from this_loc left join station_cluster on this_loc.nlc = station_cluster.cluster_nlc where cluster_id is not null
+	select cluster_id as nlc, 'cluster' as source, 2 as priority from this_loc left join station_cluster on this_loc.nlc = station_cluster.cluster_nlc where cluster_id is not null
 	union
 	-- query 3 - NLCs that exist in other groups
-	select nlc from this_group_members_loc
+	select nlc, 'group' as source, 3 as priority from this_group_members_loc
 	union
 	-- query 4 - clustered locations from group members
-	select cluster_id as nlc from this_group_members_loc left join station_cluster on this_group_members_loc.nlc = station_cluster.cluster_nlc where station_cluster.cluster_nlc is not null
+	select cluster_id as nlc, 'group cluster' as source, 4 as priority from this_group_members_loc left join station_cluster on this_group_members_loc.nlc = station_cluster.cluster_nlc where station_cluster.cluster_nlc is not null
 	union
 	-- query 5 - this location fare group
-	select fare_group as nlc from this_loc
+	select fare_group as nlc, 'fare group' as source, 5 as priority from this_loc
 	union
 	-- query 6 - clustered locations from fare group
-	select cluster_id as nlc from this_loc left join station_cluster on this_loc.fare_group = station_cluster.cluster_nlc  where cluster_id is not null
+	select cluster_id as nlc, 'fare group cluster' as source, 6 as priority from this_loc left join station_cluster on this_loc.fare_group = station_cluster.cluster_nlc  where cluster_id is not null
 	union
 	-- query 7 - (mine) lookup against zone group
-	select zone_no as nlc from this_loc where zone_no is not null
+	select zone_no as nlc, 'zone' as source, 7 as priority from this_loc where zone_no is not null
 )
-select distinct(nlc) from nlcs`
+-- the same NLC can come from several rules, keep the most specific
+select nlc, source from nlcs order by priority, nlc`
 
 // Apologies in advance
 var fares_query = `select distinct
@@ -47,6 +48,7 @@ flow.origin_code
 , flow.status_code
 , flow.usage_code
 , flow.toc
+, flow.ns_disc_ind
 , fare.flow_id
 , fare.id as fare_id
 , fare.ticket_code
@@ -66,7 +68,7 @@ where
 flow.start_date <= CURDATE() and flow.end_date > CURDATE() 
 AND route.start_date <= CURDATE() and route.end_date > CURDATE()
 AND ticket_type.start_date <= CURDATE() and ticket_type.end_date > CURDATE()
-AND ticket_type.tkt_class = '2'
+AND ticket_type.tkt_class = ?
 AND flow.route_code IN ('00000', '01000') -- default to any permitted routes for now
 AND (
 	(origin_code IN ? and destination_code in ?) 
@@ -87,6 +89,7 @@ ndfo.origin_code
 , NULL as status_code
 , NULL as usage_code
 , NULL as toc
+, NULL as ns_disc_ind
 , NULL as flow_id
 , NULL as fare_id
 , ndfo.ticket_code 
@@ -107,3 +110,70 @@ and railcard_code = ''
 and origin_code IN ?
 and destination_code in ?
 `
+
+// A station and every group it is currently a member of, one row per group
+var station_with_groups_query = `with grouped_locations as (
+	select lgm.member_uic_code , lgm.member_crs_code , lgm.group_uic_code, lg.description
+	from location_group_member lgm
+	left join location_group lg on lgm.group_uic_code = lg.group_uic_code
+	where lgm.end_date > CURDATE() and lg.start_date <= CURDATE() AND lg.end_date > CURDATE()
+)
+select location.uic , location.nlc , location.crs , location.description ,location.fare_group , location.start_date , location.end_date
+, grouped_locations.group_uic_code , grouped_locations.description as group_description
+from location
+left join grouped_locations on location.uic = grouped_locations.member_uic_code
+where location.crs = ? and location.start_date <= CURDATE() and location.end_date > CURDATE()`
+
+// Current member stations of a location group
+var group_members_query = `select location.uic, location.nlc, location.crs, location.description, location.fare_group, location.start_date, location.end_date
+from location_group_member lgm
+inner join location on lgm.member_uic_code = location.uic
+where lgm.group_uic_code = ?
+and lgm.end_date > CURDATE()
+and location.start_date <= CURDATE() and location.end_date > CURDATE()
+order by location.description`
+
+var zones_query = `select loc.nlc, loc.crs, loc.description, loc.zone_no, loc.zone_ind
+, loc.lul_zone_1, loc.lul_zone_2, loc.lul_zone_3, loc.lul_zone_4, loc.lul_zone_5, loc.lul_zone_6
+from location loc
+where loc.crs = ? and loc.start_date <= CURDATE() and loc.end_date > CURDATE()`
+
+var ticket_types_query = `select
+ticket_type.ticket_code
+, ticket_type.description
+, ticket_type.tkt_class
+, ticket_type.tkt_type
+, ticket_type.tkt_group
+, ticket_type.max_passengers
+, ticket_type.min_passengers
+, ticket_type.max_adults
+, ticket_type.max_children
+, ticket_type.validity_code
+, ticket_type.discount_category
+, ticket_type.start_date
+, ticket_type.end_date
+, ticket_validity.description as validity_desc
+, ticket_validity.out_days
+, ticket_validity.out_months
+, ticket_validity.ret_days
+, ticket_validity.ret_months
+from ticket_type
+left join ticket_validity on ticket_type.validity_code = ticket_validity.validity_code
+and ticket_validity.start_date <= CURDATE() and ticket_validity.end_date > CURDATE()
+where ticket_type.start_date <= CURDATE() and ticket_type.end_date > CURDATE()
+order by ticket_type.ticket_code`
+
+// Copies the current fares into the archive, dates are bound separately so rounds can be backdated
+var archive_fares_query = `insert into fare_history
+(round, effective_from, flow_id, origin_code, destination_code, direction, route_code, toc, ticket_code, restriction_code, fare, created_at)
+select ?, ?, flow.flow_id, flow.origin_code, flow.destination_code, flow.direction, flow.route_code, flow.toc, fare.ticket_code, fare.restriction_code, fare.fare, NOW()
+from flow
+inner join fare on flow.flow_id = fare.flow_id
+where flow.start_date <= ? and flow.end_date > ?`
+
+// Archives the adult overrides valid on a date, which only apply in the direction given
+var archive_fare_overrides_query = `insert into fare_history
+(round, effective_from, origin_code, destination_code, direction, route_code, toc, ticket_code, restriction_code, fare, override, created_at)
+select ?, ?, ndfo.origin_code, ndfo.destination_code, '', ndfo.route_code, '', ndfo.ticket_code, ndfo.restriction_code, ndfo.adult_fare, true, NOW()
+from non_derivable_fare_override ndfo
+where ndfo.start_date <= ? and ndfo.end_date > ? and ndfo.railcard_code = ''`
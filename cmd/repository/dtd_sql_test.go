@@ -19,10 +19,10 @@ const (
 	findStationsByCrsQuery             = "SELECT `uic`,`nlc`,`description`,`crs`,`fare_group`,`start_date`,`end_date` FROM `location` WHERE crs = ? AND start_date <= CURDATE() AND end_date > CURDATE()"
 	findFlowsForStationsQuery          = "SELECT flow.flow_id,flow.origin_code,flow.destination_code,flow.direction,flow.start_date,flow.end_date,flow.route_code,route.description as route_desc FROM `flow` LEFT JOIN route on flow.route_code = route.route_code WHERE (flow.origin_code = ?) AND flow.destination_code = ? AND flow.start_date <= CURDATE() AND flow.end_date > CURDATE() AND route.start_date <= CURDATE() AND route.end_date > CURDATE()"
 	findFlowsForStationsDirectionQuery = "SELECT flow.flow_id,flow.origin_code,flow.destination_code,flow.direction,flow.start_date,flow.end_date,flow.route_code,route.description as route_desc FROM `flow` LEFT JOIN route on flow.route_code = route.route_code WHERE (flow.origin_code = ?) AND flow.destination_code = ? AND flow.start_date <= CURDATE() AND flow.end_date > CURDATE() AND route.start_date <= CURDATE() AND route.end_date > CURDATE() AND flow.direction = 'R'"
-	findAllFlowsForStationQuery        = "SELECT flow.flow_id,flow.origin_code,flow.destination_code,flow.direction,flow.start_date,flow.end_date,flow.route_code,route.description as route_desc FROM `flow` LEFT JOIN route on flow.route_code = route.route_code WHERE ((origin_code = ?) OR destination_code = ?) AND start_date <= CURDATE() AND end_date > CURDATE()"
+	findAllFlowsForStationQuery        = "SELECT flow.flow_id,flow.origin_code,flow.destination_code,flow.direction,flow.start_date,flow.end_date,flow.route_code,route.description as route_desc FROM `flow` LEFT JOIN route on flow.route_code = route.route_code WHERE ((flow.origin_code = ?) OR flow.destination_code = ?) AND flow.start_date <= CURDATE() AND flow.end_date > CURDATE()"
 	findFaresForFlowQuery              = "SELECT fare.id,fare.flow_id,fare.ticket_code,fare.fare,fare.restriction_code,ticket_type.description as ticket_description,ticket_type.tkt_class as ticket_class,ticket_type.tkt_type as ticket_type,restriction_header.description as restriction_desc,restriction_header.desc_out as restriction_desc_out,restriction_header.desc_ret as restriction_desc_rtn FROM `fare` LEFT JOIN ticket_type on fare.ticket_code = ticket_type.ticket_code LEFT JOIN restriction_header on fare.restriction_code = restriction_header.restriction_code WHERE fare.flow_id IN (?) AND ticket_type.start_date <= CURDATE() AND ticket_type.end_date > CURDATE()"
 
-	findStationsByCrsQueryNew = "with grouped_locations as ( select lgm.member_uic_code , lgm.member_crs_code , lgm.group_uic_code, lg.description from location_group_member lgm left join location_group lg on lgm.group_uic_code = lg.group_uic_code where lgm.end_date > CURDATE() and lg.start_date <= CURDATE() AND lg.end_date > CURDATE() ) select location.uic , location.nlc , location.crs , location.description ,location.fare_group , location.start_date , location.end_date , grouped_locations.group_uic_code , grouped_locations.description as group_description from location left join grouped_locations on location.uic = grouped_locations.member_uic_code where location.crs = '?' and location.start_date <= CURDATE() and location.end_date > CURDATE();"
+	findStationsByCrsQueryNew = "with grouped_locations as ( select lgm.member_uic_code , lgm.member_crs_code , lgm.group_uic_code, lg.description from location_group_member lgm left join location_group lg on lgm.group_uic_code = lg.group_uic_code where lgm.end_date > CURDATE() and lg.start_date <= CURDATE() AND lg.end_date > CURDATE() ) select location.uic , location.nlc , location.crs , location.description ,location.fare_group , location.start_date , location.end_date , grouped_locations.group_uic_code , grouped_locations.description as group_description from location left join grouped_locations on location.uic = grouped_locations.member_uic_code where location.crs = ? and location.start_date <= CURDATE() and location.end_date > CURDATE()"
 )
 
 func newDateField(year int, month time.Month, day int) *time.Time {
@@ -133,6 +133,116 @@ func TestDtdRepositorySql_FindStationsByCrs(t *testing.T) {
 	}
 }
 
+func TestDtdRepositorySql_FindStationWithGroupsByCrs(t *testing.T) {
+
+	db, mock := newMock()
+
+	type fields struct {
+		db *gorm.DB
+	}
+	type args struct {
+		crs string
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		setUp   func(args)
+		want    *models.LocationWithGroups
+		wantErr error
+	}{
+		{
+			name: "should return station with no groups given ungrouped station",
+			fields: fields{
+				db: db,
+			},
+			args: args{
+				crs: "SNR",
+			},
+			setUp: func(a args) {
+				rows := sqlmock.NewRows([]string{"uic", "nlc", "crs", "description", "fare_group", "start_date", "end_date", "group_uic_code", "group_description"}).
+					AddRow("7054330", "5433", "SNR", "SANDERSTEAD", "5433", newDateField(2020, 9, 9), infiniteTime, nil, nil)
+				mock.ExpectQuery(regexp.QuoteMeta(findStationsByCrsQueryNew)).WithArgs("SNR").WillReturnRows(rows)
+			},
+			want: &models.LocationWithGroups{
+				UIC:         "7054330",
+				NLC:         "5433",
+				CRS:         "SNR",
+				FareGroup:   "5433",
+				Description: "SANDERSTEAD",
+				StartDate:   newDateField(2020, 9, 9),
+				EndDate:     infiniteTime,
+			},
+		},
+		{
+			name: "should return every group given grouped station",
+			fields: fields{
+				db: db,
+			},
+			args: args{
+				crs: "VIC",
+			},
+			setUp: func(a args) {
+				rows := sqlmock.NewRows([]string{"uic", "nlc", "crs", "description", "fare_group", "start_date", "end_date", "group_uic_code", "group_description"}).
+					AddRow("7054260", "5426", "VIC", "LONDON VICTORIA", "5426", newDateField(2020, 9, 9), infiniteTime, "7010720", "LONDON TERMINALS").
+					AddRow("7054260", "5426", "VIC", "LONDON VICTORIA", "5426", newDateField(2020, 9, 9), infiniteTime, "7007830", "LONDON VIC GROUP")
+				mock.ExpectQuery(regexp.QuoteMeta(findStationsByCrsQueryNew)).WithArgs("VIC").WillReturnRows(rows)
+			},
+			want: &models.LocationWithGroups{
+				UIC:         "7054260",
+				NLC:         "5426",
+				CRS:         "VIC",
+				FareGroup:   "5426",
+				Description: "LONDON VICTORIA",
+				StartDate:   newDateField(2020, 9, 9),
+				EndDate:     infiniteTime,
+				Groups: []*models.LocationGroup{
+					{UIC: "7010720", Description: "LONDON TERMINALS"},
+					{UIC: "7007830", Description: "LONDON VIC GROUP"},
+				},
+			},
+		},
+		{
+			name: "should return not found error given no records found",
+			fields: fields{
+				db: db,
+			},
+			args: args{
+				crs: "NOPE",
+			},
+			setUp: func(a args) {
+				rows := sqlmock.NewRows([]string{"uic", "nlc", "crs", "description", "fare_group", "start_date", "end_date", "group_uic_code", "group_description"})
+				mock.ExpectQuery(regexp.QuoteMeta(findStationsByCrsQueryNew)).WithArgs("NOPE").WillReturnRows(rows)
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dtd := &DtdRepositorySql{
+				db: tt.fields.db,
+			}
+			tt.setUp(tt.args)
+			got, err := dtd.FindStationWithGroupsByCrs(tt.args.crs)
+			if err != nil && tt.wantErr == nil {
+				assert.Fail(t, fmt.Sprintf(
+					"Error not expected but got one:\n"+
+						"error: %q", err),
+				)
+				return
+			}
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				assert.Fail(t, "Not all mocks hit", err)
+			}
+		})
+	}
+}
+
 func TestDtdRepositorySql_FindFlowsForStations(t *testing.T) {
 
 	db, mock := newMock()
@@ -543,3 +653,95 @@ func TestDtdRepositorySql_FindFaresForFlow(t *testing.T) {
 		})
 	}
 }
+
+func TestDtdRepositorySql_FindNLCsRelatedToCrs(t *testing.T) {
+
+	db, mock := newMock()
+
+	type fields struct {
+		db *gorm.DB
+	}
+	type args struct {
+		crs string
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		setUp   func(args)
+		want    []*models.RelatedNLC
+		wantErr error
+	}{
+		{
+			name: "should return related NLCs keeping the most specific source",
+			fields: fields{
+				db: db,
+			},
+			args: args{
+				crs: "VIC",
+			},
+			setUp: func(a args) {
+				rows := sqlmock.NewRows([]string{"nlc", "source"}).
+					AddRow("5426", "station").
+					AddRow("1072", "group").
+					AddRow("5426", "fare group")
+				mock.ExpectQuery(regexp.QuoteMeta(nlcs_query)).WithArgs("VIC", "VIC").WillReturnRows(rows)
+			},
+			want: []*models.RelatedNLC{
+				{NLC: "5426", Source: models.NLCSourceStation},
+				{NLC: "1072", Source: models.NLCSourceGroup},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dtd := &DtdRepositorySql{
+				db: tt.fields.db,
+			}
+			tt.setUp(tt.args)
+			got, err := dtd.FindNLCsRelatedToCrs(tt.args.crs)
+			if err != nil && tt.wantErr == nil {
+				assert.Fail(t, fmt.Sprintf(
+					"Error not expected but got one:\n"+
+						"error: %q", err),
+				)
+				return
+			}
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				assert.Fail(t, "Not all mocks hit", err)
+			}
+		})
+	}
+}
+
+func TestDtdRepositorySql_FindTicketCatalogue(t *testing.T) {
+
+	db, mock := newMock()
+
+	rows := sqlmock.NewRows([]string{"ticket_code", "description", "tkt_class", "tkt_type", "max_passengers", "validity_code", "validity_desc", "out_days"}).
+		AddRow("0AQ", "SMART 7DS", 2, "N", 1, "S1", "SEVEN DAY", 7).
+		AddRow("7DS", "SEVEN DAY   STD", 2, "N", 1, "S1", "SEVEN DAY", 7).
+		AddRow("SDR", "ANYTIME DAY R", 2, "R", 9, "DR", "DAY RETURN", 0)
+	mock.ExpectQuery(regexp.QuoteMeta(ticket_types_query)).WillReturnRows(rows)
+
+	dtd := &DtdRepositorySql{db: db}
+	got, err := dtd.FindTicketCatalogue()
+
+	assert.NoError(t, err)
+	assert.Len(t, got, 3)
+	assert.True(t, got.Lookup("0AQ").IsSeason())
+	assert.True(t, got.Lookup("0AQ").IsSmartcard())
+	assert.True(t, got.Lookup("7DS").IsSeason())
+	assert.False(t, got.Lookup("7DS").IsSmartcard())
+	assert.False(t, got.Lookup("SDR").IsSeason())
+	assert.Equal(t, uint(7), got.Lookup("7DS").OutDays)
+	assert.False(t, got.Lookup("ZZZ").IsSeason())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		assert.Fail(t, "Not all mocks hit", err)
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/pkg/errors"
+)
+
+// integrityCheck selects a single sample column describing each violating row.
+// {location}, {flow}, {fare} and {ndfo} are replaced with the tables being checked.
+type integrityCheck struct {
+	name        string
+	description string
+	query       string
+}
+
+var integrityChecks = []integrityCheck{
+	{
+		name:        "flow_origin_location",
+		description: "flows whose origin is not a known location or cluster",
+		query: `select concat(flow_id, ': ', origin_code) as sample from {flow}
+where origin_code not in (select nlc from {location})
+and origin_code not in (select cluster_id from station_cluster)`,
+	},
+	{
+		name:        "flow_destination_location",
+		description: "flows whose destination is not a known location or cluster",
+		query: `select concat(flow_id, ': ', destination_code) as sample from {flow}
+where destination_code not in (select nlc from {location})
+and destination_code not in (select cluster_id from station_cluster)`,
+	},
+	{
+		name:        "flow_date_range",
+		description: "flows that end before they start",
+		query:       `select concat(flow_id, ': ', start_date, ' - ', end_date) as sample from {flow} where start_date > end_date`,
+	},
+	{
+		name:        "flow_current_route",
+		description: "current flows whose route has no current date range",
+		query: `select concat(flow_id, ': ', route_code) as sample from {flow}
+where start_date <= CURDATE() and end_date > CURDATE()
+and route_code not in (select route_code from route where start_date <= CURDATE() and end_date > CURDATE())`,
+	},
+	{
+		name:        "fare_flow",
+		description: "fares referencing a flow that does not exist",
+		query:       `select concat(flow_id, ': ', ticket_code) as sample from {fare} where flow_id not in (select flow_id from {flow})`,
+	},
+	{
+		name:        "fare_ticket_code",
+		description: "fares referencing an unknown ticket_code",
+		query:       `select concat(flow_id, ': ', ticket_code) as sample from {fare} where ticket_code not in (select ticket_code from ticket_type)`,
+	},
+	{
+		name:        "override_ticket_code",
+		description: "fare overrides referencing an unknown ticket_code",
+		query: `select concat(origin_code, '-', destination_code, ': ', ticket_code) as sample from {ndfo}
+where ticket_code not in (select ticket_code from ticket_type)`,
+	},
+	{
+		name:        "route_date_range",
+		description: "routes that end before they start",
+		query:       `select concat(route_code, ': ', start_date, ' - ', end_date) as sample from route where start_date > end_date`,
+	},
+	{
+		name:        "restriction_header_duplicates",
+		description: "restriction codes with more than one restriction_header row",
+		query: `select concat(restriction_code, ' x', count(*)) as sample from restriction_header
+group by restriction_code having count(*) > 1`,
+	},
+}
+
+// VerifyIntegrity runs every integrity check against the live tables
+func (dtd *DtdRepositorySql) VerifyIntegrity(ctx context.Context, samples int) (results []*models.IntegrityCheckResult, err error) {
+
+	dtd = dtd.bind(ctx)
+	defer func() { err = contextError(ctx, err) }()
+	return dtd.verifyIntegrity("", samples)
+}
+
+func (dtd *DtdRepositorySql) verifyIntegrity(suffix string, samples int) (results []*models.IntegrityCheckResult, err error) {
+
+	tables := strings.NewReplacer(
+		"{location}", "location"+suffix,
+		"{flow}", "flow"+suffix,
+		"{fare}", "fare"+suffix,
+		"{ndfo}", "non_derivable_fare_override"+suffix,
+	)
+
+	for _, check := range integrityChecks {
+
+		dtd.logger().Infof("running integrity check %s", check.name)
+
+		query := tables.Replace(check.query)
+		result := &models.IntegrityCheckResult{
+			Name:        check.name,
+			Description: check.description,
+		}
+
+		err = dtd.db.Raw("select count(*) from (" + query + ") violations").Scan(&result.Violations).Error
+		if err != nil {
+			return nil, errors.Wrapf(err, "counting violations for %s", check.name)
+		}
+
+		if result.Violations > 0 && samples > 0 {
+			err = dtd.db.Raw(query+" limit ?", samples).Scan(&result.Samples).Error
+			if err != nil {
+				return nil, errors.Wrapf(err, "sampling violations for %s", check.name)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDtdRepositorySql_VerifyIntegrity(t *testing.T) {
+
+	db, mock := newMock()
+
+	for _, check := range integrityChecks {
+		count := 0
+		if check.name == "fare_ticket_code" {
+			count = 2
+		}
+		mock.ExpectQuery("select count\\(\\*\\) from \\(").
+			WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(count))
+		if count > 0 {
+			mock.ExpectQuery(regexp.QuoteMeta("select concat(flow_id, ': ', ticket_code) as sample from fare where")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"sample"}).AddRow("137711: ZZZ").AddRow("137712: ZZZ"))
+		}
+	}
+
+	dtd := &DtdRepositorySql{db: db}
+	got, err := dtd.VerifyIntegrity(context.Background(), 3)
+
+	assert.NoError(t, err)
+	assert.Len(t, got, len(integrityChecks))
+	for _, result := range got {
+		if result.Name == "fare_ticket_code" {
+			assert.Equal(t, &models.IntegrityCheckResult{
+				Name:        "fare_ticket_code",
+				Description: "fares referencing an unknown ticket_code",
+				Violations:  2,
+				Samples:     []string{"137711: ZZZ", "137712: ZZZ"},
+			}, result)
+			continue
+		}
+		assert.True(t, result.Passed(), result.Name)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		assert.Fail(t, "Not all mocks hit", err)
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "stc:span"
+
+var tracer = otel.Tracer("github.com/jdheyburn/stc/cmd/repository")
+
+// tracingPlugin starts a span for every query GORM runs, as a child of the statement's context
+type tracingPlugin struct{}
+
+var _ gorm.Plugin = &tracingPlugin{}
+
+func (tracingPlugin) Name() string {
+	return "stc:tracing"
+}
+
+func (p tracingPlugin) Initialize(db *gorm.DB) error {
+
+	cb := db.Callback()
+	for _, hook := range []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := hook.before("stc:trace_before_"+hook.name, p.start("gorm."+hook.name)); err != nil {
+			return err
+		}
+		if err := hook.after("stc:trace_after_"+hook.name, p.end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tracingPlugin) start(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		_, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemMySQL),
+		)
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func (tracingPlugin) end(db *gorm.DB) {
+
+	v, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", db.Statement.Table))
+	}
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+func TestDtdRepositorySql_tracing(t *testing.T) {
+
+	spans := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+
+	db, mock := newMock()
+	assert.NoError(t, db.Use(&tracingPlugin{}))
+	dtd := &DtdRepositorySql{db: db}
+
+	rows := sqlmock.NewRows([]string{"uic", "nlc", "description", "crs", "fare_group", "start_date", "end_date"}).
+		AddRow("7055980", "5598", "WOKING", "WOK", "5598", newDateField(2020, 1, 1), infiniteTime)
+	mock.ExpectQuery(regexp.QuoteMeta(findStationsByCrsQuery)).WithArgs("WOK").WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(findStationsByCrsQuery)).WithArgs("XXX").WillReturnError(sqlmock.ErrCancelled)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "test")
+	_, err := dtd.WithContext(ctx).FindStationsByCrs("WOK")
+	assert.NoError(t, err)
+	_, err = dtd.WithContext(ctx).FindStationsByCrs("XXX")
+	assert.Error(t, err)
+	parent.End()
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	got := spans.GetSpans()
+	if !assert.Len(t, got, 3) {
+		return
+	}
+
+	ok, failed := got[0], got[1]
+	for _, s := range []*sdktrace.SpanSnapshot{ok, failed} {
+		assert.Equal(t, "gorm.query", s.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent.SpanID())
+	}
+
+	attrs := spanAttributes(ok)
+	assert.Contains(t, attrs[semconv.DBStatementKey].AsString(), "FROM `location` WHERE crs = ?")
+	assert.Equal(t, "location", attrs["db.sql.table"].AsString())
+	assert.Equal(t, int64(1), attrs["db.rows_affected"].AsInt64())
+	assert.Equal(t, codes.Unset, ok.StatusCode)
+	assert.Equal(t, codes.Error, failed.StatusCode)
+}
+
+func spanAttributes(s *sdktrace.SpanSnapshot) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
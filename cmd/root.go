@@ -1,12 +1,15 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 var (
@@ -14,22 +17,54 @@ var (
 	cfgFile     string
 	userLicense string
 
+	// shutdownTracing flushes spans once the command has finished
+	shutdownTracing func(context.Context) error
+
 	rootCmd = &cobra.Command{
 		Use:   "stc",
 		Short: "Calculate UK season ticket",
 		Long:  `TBC`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			shutdownTracing, err = setupTracing(context.Background())
+			return err
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if err := shutdownTracing(context.Background()); err != nil {
+				logger.Warn("error flushing traces", zap.Error(err))
+			}
+			logger.Sync()
+		},
 	}
 )
 
 // Execute executes the root command.
 func Execute() error {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		logger.Error("error running command", zap.Error(err))
 		os.Exit(1)
 	}
 	return nil
 }
 
+// interruptContext is cancelled by the first interrupt, so commands can stop their queries,
+// after which a second interrupt exits straight away
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -46,11 +81,6 @@ func init() {
 	// rootCmd.AddCommand(initCmd)
 }
 
-func er(msg interface{}) {
-	fmt.Println("Error:", msg)
-	os.Exit(1)
-}
-
 func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
@@ -59,7 +89,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			er(err)
+			logger.Fatal("error finding home directory", zap.Error(err))
 		}
 
 		// Search config in home directory with name ".cobra" (without extension).
@@ -69,7 +99,15 @@ func initConfig() {
 
 	viper.AutomaticEnv()
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	configErr := viper.ReadInConfig()
+
+	l, err := newLogger(viper.GetString("log.level"), viper.GetString("log.format"))
+	if err != nil {
+		logger.Fatal("error configuring logging", zap.Error(err))
+	}
+	logger = l
+
+	if configErr == nil {
+		logger.Info("using config file", zap.String("file", viper.ConfigFileUsed()))
 	}
 }
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Season periods accepted wherever a season length is given
+const (
+	PeriodWeekly      = "weekly"
+	PeriodMonthly     = "monthly"
+	PeriodThreeMonths = "3-monthly"
+	PeriodSixMonths   = "6-monthly"
+	PeriodAnnual      = "annual"
+)
+
+// seasonPeriod is a season length, either one of the Period names or a custom number of days
+type seasonPeriod struct {
+	name string
+	days int
+}
+
+// seasonPeriodAliases maps the other ways people write a period onto its name
+var seasonPeriodAliases = map[string]string{
+	PeriodWeekly:      PeriodWeekly,
+	"week":            PeriodWeekly,
+	"7":               PeriodWeekly,
+	"7d":              PeriodWeekly,
+	PeriodMonthly:     PeriodMonthly,
+	"month":           PeriodMonthly,
+	PeriodThreeMonths: PeriodThreeMonths,
+	"3-month":         PeriodThreeMonths,
+	"3 months":        PeriodThreeMonths,
+	"quarter":         PeriodThreeMonths,
+	"quarterly":       PeriodThreeMonths,
+	PeriodSixMonths:   PeriodSixMonths,
+	"6-month":         PeriodSixMonths,
+	"6 months":        PeriodSixMonths,
+	"half-year":       PeriodSixMonths,
+	PeriodAnnual:      PeriodAnnual,
+	"year":            PeriodAnnual,
+	"yearly":          PeriodAnnual,
+	"365":             PeriodAnnual,
+	"365d":            PeriodAnnual,
+}
+
+// parseSeasonPeriod reads a period name or alias, or a custom period given as a number of days
+// between a month and a year
+func parseSeasonPeriod(period string) (seasonPeriod, error) {
+
+	p := strings.ToLower(strings.TrimSpace(period))
+	if name, ok := seasonPeriodAliases[p]; ok {
+		return seasonPeriod{name: name}, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(p, "d"))
+	if err != nil {
+		return seasonPeriod{}, errors.Errorf("unknown season period %q", period)
+	}
+
+	if days <= 31 || days > 365 {
+		return seasonPeriod{}, errors.Errorf("custom period seasons must be between 32 and 365 days, got %d", days)
+	}
+
+	return seasonPeriod{days: days}, nil
+}
+
+// price returns the price in pounds of a season for the period
+func (p seasonPeriod) price(seasons *Fares) float64 {
+	switch p.name {
+	case PeriodWeekly:
+		return seasons.WeeklyStd
+	case PeriodMonthly:
+		return seasons.MonthlyStd
+	case PeriodThreeMonths:
+		return seasons.ThreeMonthlyStd
+	case PeriodSixMonths:
+		return seasons.SixMonthlyStd
+	case PeriodAnnual:
+		return seasons.AnnualStd
+	}
+	return customPeriodPrice(seasons, p.days)
+}
+
+// end returns the last day a season of the period is valid for when it starts on start
+func (p seasonPeriod) end(start time.Time) time.Time {
+	switch p.name {
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 6)
+	case PeriodMonthly:
+		return start.AddDate(0, 1, -1)
+	case PeriodThreeMonths:
+		return start.AddDate(0, 3, -1)
+	case PeriodSixMonths:
+		return start.AddDate(0, 6, -1)
+	case PeriodAnnual:
+		return start.AddDate(1, 0, -1)
+	}
+	return start.AddDate(0, 0, p.days-1)
+}
+
+// seasonPrice returns the price in pounds of a season for a named period, or for a custom
+// period given as a number of days between a month and a year
+func seasonPrice(seasons *Fares, period string) (float64, error) {
+	p, err := parseSeasonPeriod(period)
+	if err != nil {
+		return 0, err
+	}
+	return p.price(seasons), nil
+}
+
+// seasonEnd returns the last day a season of the given period is valid for when it starts on start
+func seasonEnd(start time.Time, period string) (time.Time, error) {
+	p, err := parseSeasonPeriod(period)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return p.end(start), nil
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSeasonPeriod(t *testing.T) {
+
+	seasons := calculateFares(5300)
+	start := mustDate("2027-01-04")
+
+	tests := []struct {
+		period    string
+		wantPrice float64
+		wantEnd   string
+		wantErr   bool
+	}{
+		{period: "weekly", wantPrice: 53, wantEnd: "2027-01-10"},
+		{period: "Week", wantPrice: 53, wantEnd: "2027-01-10"},
+		{period: "month", wantPrice: 203.5, wantEnd: "2027-02-03"},
+		{period: "quarterly", wantPrice: 610.6, wantEnd: "2027-04-03"},
+		{period: "6 months", wantPrice: 1221.1, wantEnd: "2027-07-03"},
+		{period: "year", wantPrice: 2120, wantEnd: "2028-01-03"},
+		{period: "90d", wantPrice: 522.7, wantEnd: "2027-04-03"},
+		{period: "10", wantErr: true},
+		{period: "fortnightly", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			price, err := seasonPrice(seasons, tt.period)
+			end, endErr := seasonEnd(start, tt.period)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Error(t, endErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, endErr)
+			assert.InDelta(t, tt.wantPrice, price, 0.001)
+			assert.Equal(t, tt.wantEnd, end.Format(planDateLayout))
+		})
+	}
+}
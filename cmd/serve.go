@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+func init() {
+	viper.SetDefault("server.addr", ":8080")
+	viper.SetDefault("server.cache_ttl", 5*time.Minute)
+	// Changes-only feeds are published weekly so allow a little over a week
+	viper.SetDefault("server.max_feed_age", 8*24*time.Hour)
+	viper.SetDefault("server.request_timeout", 30*time.Second)
+
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", ":8080", "Address to listen on")
+	viper.BindPFlag("server.addr", serveCmd.Flags().Lookup("addr"))
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve fares over HTTP",
+	Long: `Serves fares lookups at /fares?from=CRS&to=CRS[&class=2][&season=true][&travelcard=false]
+along with Prometheus metrics at /metrics, and /healthz and /readyz probes.
+
+Station, NLC, ticket type and fare lookups are cached for server.cache_ttl, so after
+a dataset is activated fares can come from the previous dataset until the cache
+expires.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serve(cmd.Context(), viper.GetString("server.addr")); err != nil {
+			logger.Error("error running server", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// faresStatusChecker is what the probes need from the database
+type faresStatusChecker interface {
+	Ping(ctx context.Context) error
+	FaresStatus(ctx context.Context) (*models.FaresStatus, error)
+}
+
+type server struct {
+	repo    repository.DtdRepository
+	status  faresStatusChecker
+	maxAge  time.Duration
+	timeout time.Duration
+}
+
+// FaresResponse is the body returned by /fares
+type FaresResponse struct {
+	From  string                      `json:"from"`
+	To    string                      `json:"to"`
+	Fares []*models.FareDetailExtreme `json:"fares"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("error writing response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *server) handleFares(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+	cfg := &GetFaresConfig{
+		Repo:        s.repo,
+		FromStation: strings.ToUpper(q.Get("from")),
+		ToStation:   strings.ToUpper(q.Get("to")),
+		Class:       q.Get("class"),
+	}
+	if cfg.FromStation == "" || cfg.ToStation == "" {
+		writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+		return
+	}
+	if cfg.Class == "" {
+		cfg.Class = "2"
+	}
+	travelcard := true
+	for name, flag := range map[string]*bool{"season": &cfg.Season, "travelcard": &travelcard} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errors.Wrapf(err, "invalid %s", name))
+				return
+			}
+			*flag = b
+		}
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	fares, err := GetFaresContext(ctx, cfg)
+	switch {
+	case errors.Cause(err) == repository.ErrNotFound:
+		writeError(w, http.StatusNotFound, err)
+		return
+	case repository.IsTimeout(err):
+		logger.Warn("timed out getting fares", zap.Error(err))
+		writeError(w, http.StatusGatewayTimeout, err)
+		return
+	case repository.IsCanceled(err):
+		logger.Debug("fares request cancelled by client", zap.Error(err))
+		return
+	case err != nil:
+		logger.Error("error getting fares", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !travelcard {
+		catalogue, err := findTicketCatalogue(s.repo.WithContext(ctx))
+		if err != nil {
+			logger.Error("error finding ticket types", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		fares = withoutTravelcards(fares, catalogue)
+	}
+
+	writeJSON(w, http.StatusOK, &FaresResponse{From: cfg.FromStation, To: cfg.ToStation, Fares: fares})
+}
+
+// requestContext bounds the request's context by the server's request timeout, if one is set
+func (s *server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(r.Context(), s.timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// handleHealth is the liveness probe, which only needs the database to be reachable
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	if err := s.status.Ping(ctx); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady is the readiness probe, which also needs fares loaded from a recent feed
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	if err := s.status.Ping(ctx); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	status, err := s.status.FaresStatus(ctx)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	body := map[string]interface{}{"current_flows": status.CurrentFlows}
+	if status.LastFeed != nil {
+		body["last_feed_sequence"] = status.LastFeed.Sequence
+		body["last_feed_applied"] = status.LastFeed.CreatedAt
+	}
+
+	switch {
+	case !status.Loaded():
+		body["error"] = "no current fares loaded"
+	case !status.Current(time.Now(), s.maxAge):
+		body["error"] = "fares feed is out of date"
+	default:
+		body["status"] = "ok"
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+
+	writeJSON(w, http.StatusServiceUnavailable, body)
+}
+
+func (s *server) routes(reg *prometheus.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/fares", traced("/fares", http.HandlerFunc(s.handleFares)))
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func serve(ctx context.Context, addr string) error {
+
+	sqlRepo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	db, err := sqlRepo.DB()
+	if err != nil {
+		return errors.Wrap(err, "getting sql conn")
+	}
+	reg.MustRegister(repository.NewDBStatsCollector(db))
+
+	// Instrument beneath the cache so only real queries are timed
+	instrumented, err := repository.NewInstrumentedRepository(sqlRepo, reg)
+	if err != nil {
+		return err
+	}
+
+	cached, err := repository.NewCachedRepository(instrumented, viper.GetDuration("server.cache_ttl"), reg)
+	if err != nil {
+		return err
+	}
+
+	s := &server{
+		repo:    cached,
+		status:  sqlRepo,
+		maxAge:  viper.GetDuration("server.max_feed_age"),
+		timeout: viper.GetDuration("server.request_timeout"),
+	}
+
+	logger.Info("serving fares", zap.String("addr", addr))
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      s.routes(reg),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+
+	// Stop taking requests once interrupted, letting those in flight finish
+	go func() {
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			logger.Warn("error shutting down server", zap.Error(err))
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+type fakeStatus struct {
+	pingErr error
+	status  *models.FaresStatus
+}
+
+func (f *fakeStatus) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeStatus) FaresStatus(ctx context.Context) (*models.FaresStatus, error) {
+	return f.status, nil
+}
+
+// notFoundRepository can't find any station
+type notFoundRepository struct {
+	repository.DtdRepository
+}
+
+func (r notFoundRepository) WithContext(ctx context.Context) repository.DtdRepository {
+	return r
+}
+
+func (notFoundRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	return nil, repository.ErrNotFound
+}
+
+// slowRepository never finds a station before its context ends
+type slowRepository struct {
+	repository.DtdRepository
+	ctx context.Context
+}
+
+func (r slowRepository) WithContext(ctx context.Context) repository.DtdRepository {
+	return slowRepository{ctx: ctx}
+}
+
+func (r slowRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	<-r.ctx.Done()
+	return nil, errors.Wrap(r.ctx.Err(), "querying for location with groups")
+}
+
+func feedApplied(at time.Time) *models.FeedSequenceData {
+	return &models.FeedSequenceData{Model: gorm.Model{CreatedAt: at}, Sequence: 5}
+}
+
+func Test_serverProbes(t *testing.T) {
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		path       string
+		status     *fakeStatus
+		wantStatus int
+	}{
+		{"should be healthy when the database is reachable", "/healthz", &fakeStatus{}, http.StatusOK},
+		{"should be unhealthy when the database is down", "/healthz", &fakeStatus{pingErr: repository.ErrNotFound}, http.StatusServiceUnavailable},
+		{
+			name:       "should be ready with a recent feed",
+			path:       "/readyz",
+			status:     &fakeStatus{status: &models.FaresStatus{CurrentFlows: 10, LastFeed: feedApplied(now.Add(-time.Hour))}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should not be ready without current flows",
+			path:       "/readyz",
+			status:     &fakeStatus{status: &models.FaresStatus{}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "should not be ready with an old feed",
+			path:       "/readyz",
+			status:     &fakeStatus{status: &models.FaresStatus{CurrentFlows: 10, LastFeed: feedApplied(now.Add(-48 * time.Hour))}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{status: tt.status, maxAge: 24 * time.Hour}
+			rec := httptest.NewRecorder()
+			s.routes(prometheus.NewRegistry()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func Test_serverFares(t *testing.T) {
+
+	s := &server{repo: notFoundRepository{}}
+	handler := s.routes(prometheus.NewRegistry())
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"should need both stations", "/fares?from=WOK", http.StatusBadRequest},
+		{"should reject invalid flags", "/fares?from=WOK&to=WAT&season=maybe", http.StatusBadRequest},
+		{"should not find unknown stations", "/fares?from=XXX&to=WAT", http.StatusNotFound},
+		{"should serve metrics", "/metrics", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func Test_serverFares_timeout(t *testing.T) {
+
+	s := &server{repo: slowRepository{}, timeout: 10 * time.Millisecond}
+
+	rec := httptest.NewRecorder()
+	s.routes(prometheus.NewRegistry()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fares?from=WOK&to=WAT", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code, rec.Body.String())
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+func init() {
+	rootCmd.AddCommand(stationsCmd)
+	stationsCmd.AddCommand(stationsExplainCmd)
+	stationsCmd.AddCommand(stationsGroupsCmd)
+	stationsCmd.AddCommand(stationsMembersCmd)
+}
+
+var stationsCmd = &cobra.Command{
+	Use:   "stations",
+	Short: "Look up stations and the groups they belong to",
+}
+
+var stationsExplainCmd = &cobra.Command{
+	Use:   "explain <crs>",
+	Short: "Explain which NLCs fares for a station can be priced from",
+	Long: `Lists every NLC that fares for the station are looked up against, along with
+the rule that linked it: the station itself, a cluster, a station group such as
+LONDON TERMINALS, its fare group or its zone.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := explainStation(strings.ToUpper(args[0])); err != nil {
+			logger.Error("error explaining station", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var stationsGroupsCmd = &cobra.Command{
+	Use:   "groups <crs>",
+	Short: "List the station groups a station belongs to",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := stationGroups(strings.ToUpper(args[0])); err != nil {
+			logger.Error("error listing station groups", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var stationsMembersCmd = &cobra.Command{
+	Use:   "members <group crs|uic>",
+	Short: "List the stations in a group such as LONDON TERMINALS",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := groupMembers(strings.ToUpper(args[0])); err != nil {
+			logger.Error("error listing group members", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+type relatedNLCRow struct {
+	NLC         string `header:"nlc"`
+	Description string `header:"description"`
+	Source      string `header:"source"`
+}
+
+func explainStation(crs string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	station, err := repo.FindStationWithGroupsByCrs(crs)
+	if err != nil {
+		return err
+	}
+
+	related, err := repo.FindNLCsRelatedToCrs(station.CRS)
+	if err != nil {
+		return err
+	}
+
+	names, err := repo.FindLocationNamesByNLCs(models.NLCCodes(related))
+	if err != nil {
+		return err
+	}
+
+	printStation(station)
+
+	var rows []relatedNLCRow
+	for _, r := range related {
+		rows = append(rows, relatedNLCRow{
+			NLC:         r.NLC,
+			Description: names[r.NLC],
+			Source:      r.Source,
+		})
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(rows)
+
+	return nil
+}
+
+func printStation(station *models.LocationWithGroups) {
+
+	fmt.Printf("%s (%s) NLC %s\n", station.Description, station.CRS, station.NLC)
+
+	if !station.IsGroupedStation() {
+		return
+	}
+
+	names := make([]string, 0, len(station.Groups))
+	for _, g := range station.Groups {
+		names = append(names, g.Description)
+	}
+	fmt.Printf("Member of: %s\n", strings.Join(names, ", "))
+}
+
+func stationGroups(crs string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	station, err := repo.FindStationWithGroupsByCrs(crs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s) NLC %s\n", station.Description, station.CRS, station.NLC)
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(station.Groups)
+
+	return nil
+}
+
+// groupMembers accepts either the CRS of a group location or its 7 digit UIC code
+func groupMembers(group string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	uic := group
+	if !isUIC(group) {
+		station, err := repo.FindStationWithGroupsByCrs(group)
+		if err != nil {
+			return err
+		}
+		uic = station.UIC
+		fmt.Printf("%s (%s) UIC %s\n", station.Description, station.CRS, station.UIC)
+	}
+
+	members, err := repo.FindGroupMembers(uic)
+	if err != nil {
+		return err
+	}
+
+	var rows []stationRow
+	for _, m := range members {
+		rows = append(rows, stationRow{CRS: m.CRS, NLC: m.NLC, UIC: m.UIC, Description: m.Description})
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(rows)
+
+	return nil
+}
+
+type stationRow struct {
+	CRS         string `header:"crs"`
+	NLC         string `header:"nlc"`
+	UIC         string `header:"uic"`
+	Description string `header:"description"`
+}
+
+func isUIC(s string) bool {
+	if len(s) != 7 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+var ticketsSeasonOnly bool
+var ticketsClass uint
+
+func init() {
+	// Ticket codes whose fulfilment (paper, smartcard, e-ticket or flexi) or Travelcard zones
+	// aren't what their description suggests
+	viper.SetDefault("tickets.fulfilment", map[string]string{})
+	viper.SetDefault("tickets.travelcard", map[string]bool{})
+
+	rootCmd.AddCommand(ticketsCmd)
+	ticketsCmd.AddCommand(ticketsListCmd)
+	ticketsCmd.AddCommand(ticketsShowCmd)
+	ticketsListCmd.Flags().BoolVarP(&ticketsSeasonOnly, "season", "s", false, "Only list season tickets")
+	ticketsListCmd.Flags().UintVarP(&ticketsClass, "class", "c", 0, "Only list tickets of this class (1 or 2)")
+}
+
+var ticketsCmd = &cobra.Command{
+	Use:   "tickets",
+	Short: "Browse the ticket type catalogue",
+}
+
+var ticketsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List current ticket types",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listTickets(ticketsSeasonOnly, ticketsClass); err != nil {
+			logger.Error("error listing tickets", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var ticketsShowCmd = &cobra.Command{
+	Use:   "show <code>",
+	Short: "Show everything known about a ticket code",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showTicket(strings.ToUpper(args[0])); err != nil {
+			logger.Error("error showing ticket", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// ticketOverrides reads the ticket codes pinned in config, which win over the description heuristics
+func ticketOverrides() (*models.TicketOverrides, error) {
+
+	overrides := &models.TicketOverrides{
+		Fulfilment: map[string]models.Fulfilment{},
+		Travelcard: map[string]bool{},
+	}
+
+	// Config keys are case insensitive so come back lower case
+	for code, value := range viper.GetStringMapString("tickets.fulfilment") {
+		fulfilment := models.Fulfilment(strings.ToLower(value))
+		switch fulfilment {
+		case models.FulfilmentPaper, models.FulfilmentSmartcard, models.FulfilmentETicket, models.FulfilmentFlexi:
+		default:
+			return nil, errors.Errorf("unknown fulfilment %q for ticket code %s", value, strings.ToUpper(code))
+		}
+		overrides.Fulfilment[strings.ToUpper(code)] = fulfilment
+	}
+
+	for code, value := range viper.GetStringMapString("tickets.travelcard") {
+		travelcard, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing travelcard for ticket code %s", strings.ToUpper(code))
+		}
+		overrides.Travelcard[strings.ToUpper(code)] = travelcard
+	}
+
+	return overrides, nil
+}
+
+// findTicketCatalogue loads the ticket catalogue with the configured overrides applied
+func findTicketCatalogue(repo repository.DtdRepository) (models.TicketCatalogue, error) {
+
+	overrides, err := ticketOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	catalogue, err := repo.FindTicketCatalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	return catalogue.WithOverrides(overrides), nil
+}
+
+type ticketRow struct {
+	TicketCode    string `header:"ticket_code"`
+	Description   string `header:"description"`
+	Class         uint   `header:"class"`
+	Type          string `header:"type"`
+	MaxPassengers uint   `header:"max_passengers"`
+	Validity      string `header:"validity"`
+	Season        bool   `header:"season"`
+	Smartcard     bool   `header:"smartcard"`
+}
+
+func listTickets(seasonOnly bool, class uint) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	overrides, err := ticketOverrides()
+	if err != nil {
+		return err
+	}
+
+	types, err := repo.FindTicketTypes()
+	if err != nil {
+		return err
+	}
+
+	var rows []ticketRow
+	for _, t := range types {
+		t = overrides.Apply(t)
+		if seasonOnly && !t.IsSeason() {
+			continue
+		}
+		if class != 0 && t.TktClass != class {
+			continue
+		}
+		rows = append(rows, ticketRow{
+			TicketCode:    t.TicketCode,
+			Description:   t.Description,
+			Class:         t.TktClass,
+			Type:          t.TktType,
+			MaxPassengers: t.MaxPassengers,
+			Validity:      t.ValidityDesc,
+			Season:        t.IsSeason(),
+			Smartcard:     t.IsSmartcard(),
+		})
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(rows)
+
+	return nil
+}
+
+func showTicket(code string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return err
+	}
+
+	t, ok := catalogue[code]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	printTicket(t)
+
+	return nil
+}
+
+func printTicket(t *models.TicketTypeData) {
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"Ticket code", t.TicketCode},
+		{"Description", t.Description},
+		{"Class", t.TktClass},
+		{"Type", t.TktType},
+		{"Group", t.TktGroup},
+		{"Passengers", fmt.Sprintf("%v - %v (max %v adults, %v children)", t.MinPassengers, t.MaxPassengers, t.MaxAdults, t.MaxChildren)},
+		{"Validity", fmt.Sprintf("%s (%s)", t.ValidityDesc, t.ValidityCode)},
+		{"Outward validity", fmt.Sprintf("%v days %v months", t.OutDays, t.OutMonths)},
+		{"Return validity", fmt.Sprintf("%v days %v months", t.RetDays, t.RetMonths)},
+		{"Discount category", t.DiscountCategory},
+		{"Season", t.IsSeason()},
+		{"Smartcard", t.IsSmartcard()},
+		{"Travelcard", t.IsTravelcard()},
+	}
+	for _, f := range fields {
+		fmt.Printf("%-18s %v\n", f.name+":", f.value)
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findTicketCatalogue_overrides(t *testing.T) {
+
+	viper.Set("tickets.fulfilment", map[string]interface{}{"7ds": "smartcard"})
+	viper.Set("tickets.travelcard", map[string]interface{}{"ctc": false, "0tc": true})
+	defer viper.Set("tickets.fulfilment", map[string]string{})
+	defer viper.Set("tickets.travelcard", map[string]bool{})
+
+	shared := models.NewTicketCatalogue([]*models.TicketTypeData{
+		{TicketCode: "7DS", Description: "SEVEN DAY   STD", TktType: "N"},
+		{TicketCode: "CTC", Description: "CTCD RETURN", TktType: "R"},
+		{TicketCode: "0TC", Description: "ZONES 1-6 SEASON", TktType: "N"},
+		{TicketCode: "TCS", Description: "ANYTIME DAY TC S", TktType: "S"},
+		{TicketCode: "SDS", Description: "ANYTIME DAY S", TktType: "S"},
+	})
+
+	catalogue, err := findTicketCatalogue(&stubRepository{catalogue: shared})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		code       string
+		fulfilment models.Fulfilment
+		travelcard bool
+	}{
+		{"7DS", models.FulfilmentSmartcard, false},
+		{"CTC", models.FulfilmentPaper, false},
+		{"0TC", models.FulfilmentPaper, true},
+		// Not overridden so still worked out from the description
+		{"TCS", models.FulfilmentPaper, true},
+		{"SDS", models.FulfilmentPaper, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			ticket := catalogue.Lookup(tt.code)
+			assert.Equal(t, tt.fulfilment, ticket.Fulfilment())
+			assert.Equal(t, tt.travelcard, ticket.IsTravelcard())
+		})
+	}
+
+	// The repository's catalogue may be cached so must be left as it was
+	assert.Equal(t, models.FulfilmentPaper, shared["7DS"].Fulfilment())
+	assert.False(t, shared["0TC"].IsTravelcard())
+}
+
+func Test_ticketOverrides_invalid(t *testing.T) {
+
+	viper.Set("tickets.fulfilment", map[string]interface{}{"7ds": "carrier pigeon"})
+	defer viper.Set("tickets.fulfilment", map[string]string{})
+
+	_, err := ticketOverrides()
+	assert.EqualError(t, err, `unknown fulfilment "carrier pigeon" for ticket code 7DS`)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+// tracer is resolved through the global provider, so spans are no-ops until tracing is set up
+var tracer = otel.Tracer("github.com/jdheyburn/stc/cmd")
+
+func init() {
+	viper.SetDefault("tracing.exporter", TraceExporterNone)
+	viper.SetDefault("tracing.endpoint", "localhost:4317")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.service_name", "stc")
+
+	rootCmd.PersistentFlags().String("trace", TraceExporterNone, "Export traces to none, stdout or otlp")
+	viper.BindPFlag("tracing.exporter", rootCmd.PersistentFlags().Lookup("trace"))
+
+	// Continue traces from callers even when spans aren't exported here
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// newSpanExporter builds the exporter named in config, or nil when tracing is off
+func newSpanExporter(ctx context.Context, name, endpoint string, insecure bool, w io.Writer) (sdktrace.SpanExporter, error) {
+
+	switch name {
+	case "", TraceExporterNone:
+		return nil, nil
+	case TraceExporterStdout:
+		return stdout.NewExporter(stdout.WithWriter(w), stdout.WithPrettyPrint(), stdout.WithoutMetricExport())
+	case TraceExporterOTLP:
+		opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlpgrpc.WithInsecure())
+		}
+		exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(opts...))
+		return exporter, errors.Wrapf(err, "connecting to otlp collector at %s", endpoint)
+	default:
+		return nil, errors.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// setupTracing installs the global tracer provider, returning a func that flushes any buffered spans
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+
+	exporter, err := newSpanExporter(ctx,
+		viper.GetString("tracing.exporter"),
+		viper.GetString("tracing.endpoint"),
+		viper.GetBool("tracing.insecure"),
+		os.Stderr,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(viper.GetString("tracing.service_name")))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on the span, if there was one, before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusRecorder remembers the status code written so it can be added to the request span
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// traced starts a server span for each request, continuing any trace propagated by the caller
+func traced(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("stc", route, r)...),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rec.status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(rec.status))
+	})
+}
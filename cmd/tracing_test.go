@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/repository"
+)
+
+// spans is shared by the package as the global tracer provider can only be swapped in once
+var spans = tracetest.NewInMemoryExporter()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+}
+
+// stubRepository answers every GetFares lookup from fixed data
+type stubRepository struct {
+	repository.DtdRepository
+	nlcs      map[string][]*models.RelatedNLC
+	fares     []*models.FareDetailExtreme
+	catalogue models.TicketCatalogue
+}
+
+func (r *stubRepository) WithContext(ctx context.Context) repository.DtdRepository {
+	return r
+}
+
+func (r *stubRepository) FindStationWithGroupsByCrs(crs string) (*models.LocationWithGroups, error) {
+	return &models.LocationWithGroups{CRS: crs}, nil
+}
+
+func (r *stubRepository) FindNLCsRelatedToCrs(crs string) ([]*models.RelatedNLC, error) {
+	return r.nlcs[crs], nil
+}
+
+func (r *stubRepository) FindFaresForNLCs(srcNlcs, dstNlcs []string, season bool, class string) ([]*models.FareDetailExtreme, error) {
+	return r.fares, nil
+}
+
+func (r *stubRepository) FindTicketCatalogue() (models.TicketCatalogue, error) {
+	return r.catalogue, nil
+}
+
+func spanAttributes(s *sdktrace.SpanSnapshot) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func Test_GetFaresContext_traces(t *testing.T) {
+
+	spans.Reset()
+
+	repo := &stubRepository{
+		nlcs: map[string][]*models.RelatedNLC{
+			"WOK": {{NLC: "5598", Source: models.NLCSourceStation}},
+			"WAT": {{NLC: "5598"}, {NLC: "1072"}, {NLC: "0032"}},
+		},
+		fares: []*models.FareDetailExtreme{{TicketCode: "7DS"}, {TicketCode: "7DF"}},
+	}
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "test")
+	_, err := GetFaresContext(ctx, &GetFaresConfig{Repo: repo, FromStation: "WOK", ToStation: "WAT", Season: true, Class: "2"})
+	root.End()
+	assert.NoError(t, err)
+
+	byName := map[string][]*sdktrace.SpanSnapshot{}
+	for _, s := range spans.GetSpans() {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+
+	getFares := byName["GetFares"]
+	if assert.Len(t, getFares, 1) {
+		assert.Equal(t, root.SpanContext().SpanID(), getFares[0].Parent.SpanID())
+		attrs := spanAttributes(getFares[0])
+		assert.Equal(t, int64(1), attrs["stc.src_nlcs"].AsInt64())
+		assert.Equal(t, int64(3), attrs["stc.dst_nlcs"].AsInt64())
+		assert.Equal(t, int64(2), attrs["stc.fares"].AsInt64())
+	}
+
+	assert.Len(t, byName["FindStationWithGroupsByCrs"], 2)
+	assert.Len(t, byName["FindNLCsRelatedToCrs"], 2)
+	if assert.Len(t, byName["FindFaresForNLCs"], 1) {
+		s := byName["FindFaresForNLCs"][0]
+		assert.Equal(t, getFares[0].SpanContext.SpanID(), s.Parent.SpanID())
+		assert.Equal(t, int64(2), spanAttributes(s)["stc.rows"].AsInt64())
+	}
+	// Seasons have no overrides to look up
+	assert.Empty(t, byName["FindFareOverridesForNLCs"])
+}
+
+func Test_traced(t *testing.T) {
+
+	spans.Reset()
+
+	handler := traced("/fares", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/fares?from=WOK&to=XXX", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := spans.GetSpans()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, "/fares", got[0].Name)
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", got[0].SpanContext.TraceID().String())
+		assert.Equal(t, int64(http.StatusNotFound), spanAttributes(got[0])["http.status_code"].AsInt64())
+	}
+}
+
+func Test_newSpanExporter(t *testing.T) {
+
+	exporter, err := newSpanExporter(context.Background(), TraceExporterNone, "", true, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	_, err = newSpanExporter(context.Background(), "zipkin", "", true, nil)
+	assert.EqualError(t, err, `unknown trace exporter "zipkin"`)
+}
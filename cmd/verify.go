@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var verifySamples int
+
+func init() {
+	dbCmd.AddCommand(dbVerifyCmd)
+	dbVerifyCmd.Flags().IntVar(&verifySamples, "samples", 5, "Number of sample violations to show per check")
+}
+
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the fares database for referential and date range problems",
+	Long: `Runs a suite of integrity checks against the live fares tables and reports
+how many rows violate each one. Exits non-zero if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		passed, err := verify(cmd.Context(), verifySamples)
+		if err != nil {
+			logger.Error("error verifying database", zap.Error(err))
+			os.Exit(1)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+	},
+}
+
+func verify(ctx context.Context, samples int) (bool, error) {
+
+	repo, err := newRepository()
+	if err != nil {
+		return false, err
+	}
+
+	results, err := repo.VerifyIntegrity(ctx, samples)
+	if err != nil {
+		return false, err
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(results)
+
+	passed := true
+	for _, result := range results {
+		if result.Passed() {
+			continue
+		}
+		passed = false
+		if len(result.Samples) > 0 {
+			fmt.Printf("\n%s samples:\n  %s\n", result.Name, strings.Join(result.Samples, "\n  "))
+		}
+	}
+
+	return passed, nil
+}
@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+	"github.com/jdheyburn/stc/cmd/watch"
+)
+
+var (
+	watchClass       string
+	watchTicketCodes []string
+	watchNotify      []string
+)
+
+func init() {
+	viper.SetDefault("watch.store", "")
+	viper.SetDefault("watch.notify", []string{"stdout"})
+	viper.SetDefault("watch.smtp.addr", "localhost:25")
+	viper.SetDefault("watch.smtp.from", "stc@localhost")
+	viper.SetDefault("watch.smtp.to", []string{})
+	viper.SetDefault("watch.webhook.url", "")
+
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.AddCommand(watchAddCmd)
+	watchCmd.AddCommand(watchListCmd)
+	watchCmd.AddCommand(watchRemoveCmd)
+	watchCmd.AddCommand(watchCheckCmd)
+
+	watchAddCmd.Flags().StringVarP(&fromStation, "from", "f", "", "Origin station CRS code")
+	watchAddCmd.Flags().StringVarP(&toStation, "to", "t", "", "Destination station CRS code")
+	watchAddCmd.Flags().StringVarP(&watchClass, "class", "c", "2", "Class of fares to watch")
+	watchAddCmd.Flags().StringSliceVar(&watchTicketCodes, "ticket-code", nil, "Ticket codes to watch (default all)")
+	watchAddCmd.MarkFlagRequired("from")
+	watchAddCmd.MarkFlagRequired("to")
+
+	watchCheckCmd.Flags().StringSliceVar(&watchNotify, "notify", nil, "Where to send changes: stdout, smtp and/or webhook (default from watch.notify config)")
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch journeys for fare changes",
+}
+
+var watchAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Start watching a journey",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := addWatch(strings.ToUpper(fromStation), strings.ToUpper(toStation), watchClass, watchTicketCodes); err != nil {
+			logger.Error("error adding watch", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var watchListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List watched journeys",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listWatches(); err != nil {
+			logger.Error("error listing watches", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var watchRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Stop watching a journey",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := removeWatch(args[0]); err != nil {
+			logger.Error("error removing watch", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var watchCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compare watched journeys with the current fares and notify of changes",
+	Long: `Looks up the current fares for every watched journey and compares the cheapest
+fare for each ticket code with what was seen at the last check, sending any changes
+to the configured notifiers. Run it after each fares import. The first check of a
+journey records its fares without notifying.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkWatches(cmd.Context(), watchNotify); err != nil {
+			logger.Error("error checking watches", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// watchStorePath is the configured store or ~/.stc/watchlist.json
+func watchStorePath() (string, error) {
+	if path := viper.GetString("watch.store"); path != "" {
+		return path, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "finding home directory")
+	}
+	return filepath.Join(home, ".stc", "watchlist.json"), nil
+}
+
+func loadWatchStore() (*watch.Store, error) {
+	path, err := watchStorePath()
+	if err != nil {
+		return nil, err
+	}
+	return watch.Load(path)
+}
+
+// notifiers builds the named notification sinks from config
+func notifiers(names []string) ([]watch.Notifier, error) {
+
+	if len(names) == 0 {
+		names = viper.GetStringSlice("watch.notify")
+	}
+
+	var sinks []watch.Notifier
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "stdout":
+			sinks = append(sinks, &watch.WriterNotifier{W: os.Stdout})
+		case "smtp":
+			sinks = append(sinks, &watch.SMTPNotifier{
+				Addr: viper.GetString("watch.smtp.addr"),
+				From: viper.GetString("watch.smtp.from"),
+				To:   viper.GetStringSlice("watch.smtp.to"),
+			})
+		case "webhook":
+			url := viper.GetString("watch.webhook.url")
+			if url == "" {
+				return nil, errors.New("watch.webhook.url must be set to use the webhook notifier")
+			}
+			sinks = append(sinks, &watch.WebhookNotifier{URL: url})
+		default:
+			return nil, errors.Errorf("unknown notifier %q", name)
+		}
+	}
+
+	return sinks, nil
+}
+
+// cheapestByTicketCode returns the cheapest adult fare for each ticket code
+func cheapestByTicketCode(fares []*models.FareDetailExtreme) map[string]uint {
+	cheapest := map[string]uint{}
+	for _, fare := range fares {
+		if current, ok := cheapest[fare.TicketCode]; !ok || fare.AdultFare < current {
+			cheapest[fare.TicketCode] = fare.AdultFare
+		}
+	}
+	return cheapest
+}
+
+func addWatch(from, to, class string, ticketCodes []string) error {
+
+	store, err := loadWatchStore()
+	if err != nil {
+		return err
+	}
+
+	for i, code := range ticketCodes {
+		ticketCodes[i] = strings.ToUpper(code)
+	}
+
+	w := store.Add(&watch.Watch{From: from, To: to, Class: class, TicketCodes: ticketCodes})
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Watching %s to %s as watch %d\n", from, to, w.ID)
+
+	return nil
+}
+
+func listWatches() error {
+
+	store, err := loadWatchStore()
+	if err != nil {
+		return err
+	}
+
+	printer := tableprinter.New(os.Stdout)
+	printer.Print(store.Watches)
+
+	return nil
+}
+
+func removeWatch(arg string) error {
+
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.Wrapf(err, "invalid watch id %q", arg)
+	}
+
+	store, err := loadWatchStore()
+	if err != nil {
+		return err
+	}
+
+	if err := store.Remove(id); err != nil {
+		return err
+	}
+
+	return store.Save()
+}
+
+func checkWatches(ctx context.Context, notify []string) error {
+
+	sinks, err := notifiers(notify)
+	if err != nil {
+		return err
+	}
+
+	store, err := loadWatchStore()
+	if err != nil {
+		return err
+	}
+
+	if len(store.Watches) == 0 {
+		fmt.Println("No journeys are being watched")
+		return nil
+	}
+
+	repo, err := newRepositoryContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	catalogue, err := findTicketCatalogue(repo)
+	if err != nil {
+		return errors.Wrapf(err, "finding ticket types")
+	}
+
+	var changes []*watch.Change
+	failed := 0
+	now := time.Now()
+
+	for _, w := range store.Watches {
+		fares, err := GetFaresContext(ctx, &GetFaresConfig{
+			Repo:        repo,
+			FromStation: w.From,
+			ToStation:   w.To,
+			Class:       w.Class,
+		})
+		if err != nil {
+			// One bad journey shouldn't stop the others being checked
+			logger.Error("error checking watch", zap.Int("id", w.ID), zap.Error(err))
+			failed++
+			continue
+		}
+
+		// Travelcards are only watched when asked for by ticket code
+		if len(w.TicketCodes) == 0 {
+			fares = withoutTravelcards(fares, catalogue)
+		}
+
+		changes = append(changes, watch.Check(w, cheapestByTicketCode(fares), now)...)
+	}
+
+	if len(changes) > 0 {
+		for _, sink := range sinks {
+			if err := sink.Notify(changes); err != nil {
+				return errors.Wrap(err, "sending notifications")
+			}
+		}
+	}
+
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	logger.Info("checked watches", zap.Int("watches", len(store.Watches)), zap.Int("changes", len(changes)), zap.Int("failed", failed))
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d watches could not be checked", failed, len(store.Watches))
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package watch
+
+import (
+	"sort"
+	"time"
+)
+
+// Change is a fare on a watched journey that differs from when it was last checked.
+// Old is zero for a newly available ticket code and New is zero for one no longer sold.
+type Change struct {
+	Watch      *Watch
+	TicketCode string
+	Old        uint
+	New        uint
+}
+
+// Check compares the cheapest current fares for each ticket code with those last seen,
+// records the current fares on the watch and returns what changed. The first check of
+// a watch only records a baseline.
+func Check(w *Watch, current map[string]uint, now time.Time) []*Change {
+
+	seen := map[string]uint{}
+	for code, fare := range current {
+		if w.Watches(code) {
+			seen[code] = fare
+		}
+	}
+
+	var changes []*Change
+	if w.LastSeen != nil {
+		for code, fare := range seen {
+			if old := w.LastSeen[code]; old != fare {
+				changes = append(changes, &Change{Watch: w, TicketCode: code, Old: old, New: fare})
+			}
+		}
+		for code, old := range w.LastSeen {
+			if _, ok := seen[code]; !ok {
+				changes = append(changes, &Change{Watch: w, TicketCode: code, Old: old})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].TicketCode < changes[j].TicketCode
+	})
+
+	w.LastSeen = seen
+	w.LastChecked = now
+
+	return changes
+}
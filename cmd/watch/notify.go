@@ -0,0 +1,137 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Notifier sends fare changes somewhere they will be seen
+type Notifier interface {
+	Notify(changes []*Change) error
+}
+
+// Describe summarises a change in a single line
+func (c *Change) Describe() string {
+	journey := fmt.Sprintf("%s to %s class %s %s", c.Watch.From, c.Watch.To, c.Watch.Class, c.TicketCode)
+	switch {
+	case c.Old == 0:
+		return fmt.Sprintf("%s now available at £%.2f", journey, pounds(c.New))
+	case c.New == 0:
+		return fmt.Sprintf("%s no longer available, was £%.2f", journey, pounds(c.Old))
+	}
+	pct := (float64(c.New) - float64(c.Old)) / float64(c.Old) * 100
+	return fmt.Sprintf("%s changed from £%.2f to £%.2f (%+.1f%%)", journey, pounds(c.Old), pounds(c.New), pct)
+}
+
+func pounds(pence uint) float64 {
+	return float64(pence) / 100
+}
+
+// WriterNotifier writes a line per change, such as to stdout
+type WriterNotifier struct {
+	W io.Writer
+}
+
+func (n *WriterNotifier) Notify(changes []*Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(n.W, c.Describe()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SMTPNotifier emails the changes through an SMTP server, without authentication
+// as it is meant for a local relay
+type SMTPNotifier struct {
+	Addr string
+	From string
+	To   []string
+}
+
+// message builds the email sent for a set of changes
+func (n *SMTPNotifier) message(changes []*Change) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: stc: %d fare changes on watched journeys\r\n", len(changes))
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	for _, c := range changes {
+		fmt.Fprintf(&b, "%s\r\n", c.Describe())
+	}
+	return b.Bytes()
+}
+
+func (n *SMTPNotifier) Notify(changes []*Change) error {
+	if len(n.To) == 0 {
+		return errors.New("no recipients for smtp notifications")
+	}
+	return errors.Wrap(smtp.SendMail(n.Addr, nil, n.From, n.To, n.message(changes)), "sending fare change email")
+}
+
+// WebhookNotifier posts the changes as JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// webhookChange is the JSON body sent for each change
+type webhookChange struct {
+	WatchID    int     `json:"watch_id"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Class      string  `json:"class"`
+	TicketCode string  `json:"ticket_code"`
+	Old        float64 `json:"old"`
+	New        float64 `json:"new"`
+	Message    string  `json:"message"`
+}
+
+func (n *WebhookNotifier) Notify(changes []*Change) error {
+
+	body := struct {
+		Changes []webhookChange `json:"changes"`
+	}{}
+	for _, c := range changes {
+		body.Changes = append(body.Changes, webhookChange{
+			WatchID:    c.Watch.ID,
+			From:       c.Watch.From,
+			To:         c.Watch.To,
+			Class:      c.Watch.Class,
+			TicketCode: c.TicketCode,
+			Old:        pounds(c.Old),
+			New:        pounds(c.New),
+			Message:    c.Describe(),
+		})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "encoding webhook body")
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "posting fare changes")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
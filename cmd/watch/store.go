@@ -0,0 +1,116 @@
+// Package watch keeps a local list of watched journeys and notifies when their fares change
+package watch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when a watch does not exist
+var ErrNotFound = errors.New("watch not found")
+
+// Watch is a journey whose fares are checked for changes
+type Watch struct {
+	ID          int       `json:"id" header:"id"`
+	From        string    `json:"from" header:"from"`
+	To          string    `json:"to" header:"to"`
+	Class       string    `json:"class" header:"class"`
+	TicketCodes []string  `json:"ticket_codes,omitempty" header:"ticket_codes"`
+	LastChecked time.Time `json:"last_checked,omitempty" header:"last_checked"`
+	// LastSeen is the cheapest fare in pence for each ticket code at the last check
+	LastSeen map[string]uint `json:"last_seen,omitempty" header:"-"`
+}
+
+// Watches reports whether the watch covers a ticket code, which is all of them if none were given
+func (w *Watch) Watches(ticketCode string) bool {
+	if len(w.TicketCodes) == 0 {
+		return true
+	}
+	for _, code := range w.TicketCodes {
+		if strings.EqualFold(code, ticketCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is a JSON file of watches
+type Store struct {
+	path    string
+	Watches []*Watch `json:"watches"`
+}
+
+// Load reads the store at path, which is empty if the file does not exist yet
+func Load(path string) (*Store, error) {
+
+	s := &Store{path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading watch store")
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Wrapf(err, "parsing watch store %s", path)
+	}
+
+	return s, nil
+}
+
+// Save writes the store back to its file, creating the directory if needed
+func (s *Store) Save() error {
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return errors.Wrap(err, "creating watch store directory")
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding watch store")
+	}
+
+	// Write then rename so a failed write doesn't lose the existing watches
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "writing watch store")
+	}
+
+	return errors.Wrap(os.Rename(tmp, s.path), "replacing watch store")
+}
+
+// Add stores a new watch, giving it the next free ID
+func (s *Store) Add(w *Watch) *Watch {
+	next := 1
+	for _, existing := range s.Watches {
+		if existing.ID >= next {
+			next = existing.ID + 1
+		}
+	}
+	w.ID = next
+	s.Watches = append(s.Watches, w)
+	sort.Slice(s.Watches, func(i, j int) bool {
+		return s.Watches[i].ID < s.Watches[j].ID
+	})
+	return w
+}
+
+// Remove deletes a watch by ID
+func (s *Store) Remove(id int) error {
+	for i, w := range s.Watches {
+		if w.ID == id {
+			s.Watches = append(s.Watches[:i], s.Watches[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrNotFound, "watch %d", id)
+}
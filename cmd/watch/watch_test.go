@@ -0,0 +1,111 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "watch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nested", "watchlist.json")
+
+	store, err := Load(path)
+	assert.NoError(t, err)
+	assert.Empty(t, store.Watches)
+
+	store.Add(&Watch{From: "WOK", To: "WAT", Class: "2"})
+	store.Add(&Watch{From: "GLD", To: "WAT", Class: "1", TicketCodes: []string{"7DS"}})
+	assert.NoError(t, store.Remove(1))
+	store.Add(&Watch{From: "SNR", To: "VIC", Class: "2"})
+	assert.NoError(t, store.Save())
+
+	loaded, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Watches, 2)
+	assert.Equal(t, 2, loaded.Watches[0].ID)
+	assert.Equal(t, []string{"7DS"}, loaded.Watches[0].TicketCodes)
+	assert.Equal(t, 3, loaded.Watches[1].ID)
+
+	assert.Equal(t, ErrNotFound, errors.Cause(loaded.Remove(9)))
+}
+
+func TestCheck(t *testing.T) {
+
+	now := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	w := &Watch{From: "WOK", To: "WAT", Class: "2", TicketCodes: []string{"7DS", "SDR", "CDR"}}
+
+	changes := Check(w, map[string]uint{"7DS": 5000, "SDR": 1600, "SOS": 1000}, now)
+	assert.Empty(t, changes, "first check only records a baseline")
+	assert.Equal(t, map[string]uint{"7DS": 5000, "SDR": 1600}, w.LastSeen)
+	assert.Equal(t, now, w.LastChecked)
+
+	changes = Check(w, map[string]uint{"7DS": 5100, "CDR": 950, "SOS": 1100}, now)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, &Change{Watch: w, TicketCode: "7DS", Old: 5000, New: 5100}, changes[0])
+	assert.Equal(t, &Change{Watch: w, TicketCode: "CDR", Old: 0, New: 950}, changes[1])
+	assert.Equal(t, &Change{Watch: w, TicketCode: "SDR", Old: 1600, New: 0}, changes[2])
+
+	assert.Equal(t, "WOK to WAT class 2 7DS changed from £50.00 to £51.00 (+2.0%)", changes[0].Describe())
+	assert.Equal(t, "WOK to WAT class 2 CDR now available at £9.50", changes[1].Describe())
+	assert.Equal(t, "WOK to WAT class 2 SDR no longer available, was £16.00", changes[2].Describe())
+}
+
+func TestNotifiers(t *testing.T) {
+
+	w := &Watch{ID: 4, From: "WOK", To: "WAT", Class: "2"}
+	changes := []*Change{{Watch: w, TicketCode: "7DS", Old: 5000, New: 5100}}
+
+	t.Run("should write a line per change", func(t *testing.T) {
+		var b bytes.Buffer
+		assert.NoError(t, (&WriterNotifier{W: &b}).Notify(changes))
+		assert.Equal(t, "WOK to WAT class 2 7DS changed from £50.00 to £51.00 (+2.0%)\n", b.String())
+	})
+
+	t.Run("should build an email", func(t *testing.T) {
+		n := &SMTPNotifier{From: "stc@localhost", To: []string{"a@example.com", "b@example.com"}}
+		msg := string(n.message(changes))
+		assert.True(t, strings.HasPrefix(msg, "From: stc@localhost\r\nTo: a@example.com, b@example.com\r\nSubject: stc: 1 fare changes"))
+		assert.Contains(t, msg, "7DS changed from £50.00 to £51.00")
+	})
+
+	t.Run("should post changes to a webhook", func(t *testing.T) {
+		var got struct {
+			Changes []webhookChange `json:"changes"`
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			rw.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		assert.NoError(t, (&WebhookNotifier{URL: server.URL}).Notify(changes))
+		assert.Len(t, got.Changes, 1)
+		assert.Equal(t, 4, got.Changes[0].WatchID)
+		assert.Equal(t, 51.0, got.Changes[0].New)
+	})
+
+	t.Run("should fail on webhook errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		assert.Error(t, (&WebhookNotifier{URL: server.URL}).Notify(changes))
+	})
+}
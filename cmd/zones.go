@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/jdheyburn/stc/cmd/models"
+)
+
+func init() {
+	rootCmd.AddCommand(zonesCmd)
+}
+
+var zonesCmd = &cobra.Command{
+	Use:   "zones <crs>",
+	Short: "Show the fare zone and London Travelcard zones of a station",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := zones(strings.ToUpper(args[0])); err != nil {
+			logger.Error("error looking up zones", zap.Error(err))
+			os.Exit(1)
+		}
+	},
+}
+
+func zones(crs string) error {
+
+	repo, err := newRepository()
+	if err != nil {
+		return err
+	}
+
+	z, err := repo.FindZonesForCrs(crs)
+	if err != nil {
+		return err
+	}
+
+	printZones(z)
+
+	return nil
+}
+
+func printZones(z *models.StationZones) {
+
+	fmt.Printf("%s (%s) NLC %s\n", z.Description, z.CRS, z.NLC)
+
+	if z.ZoneNo != "" {
+		fmt.Printf("  Fare zone: %s %s\n", z.ZoneNo, z.ZoneDescription)
+	}
+
+	if !z.InLondonZones() {
+		fmt.Println("  Outside the London Travelcard zones")
+		return
+	}
+
+	zones := make([]string, 0, len(z.LULZones))
+	for _, zone := range z.LULZones {
+		zones = append(zones, strconv.Itoa(zone))
+	}
+	fmt.Printf("  London Travelcard zones: %s\n", strings.Join(zones, ", "))
+}